@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	log "github.com/sirupsen/logrus"
+	"io"
+)
+
+const (
+	// EventLoginSucceeded is recorded when user is authenticated with password
+	EventLoginSucceeded = "login_succeeded"
+	// EventLoginFailed is recorded when password check fails or account doesn't exist
+	EventLoginFailed = "login_failed"
+	// EventLoginBlocked is recorded when login is rejected because of previous failures
+	EventLoginBlocked = "login_blocked"
+	// EventAccountLocked is recorded when failures of the account reach lockout threshold
+	EventAccountLocked = "account_locked"
+	// EventAccountUnlocked is recorded when administrator unlocks the account
+	EventAccountUnlocked = "account_unlocked"
+	// EventMFARequired is recorded when password is correct and login waits for second factor
+	EventMFARequired = "mfa_required"
+	// EventMFAEnabled is recorded when user enables second factor
+	EventMFAEnabled = "mfa_enabled"
+	// EventAPIKeyCreated is recorded when user creates api key
+	EventAPIKeyCreated = "api_key_created"
+	// EventAPIKeyRevoked is recorded when user revokes api key
+	EventAPIKeyRevoked = "api_key_revoked"
+	// EventEmailChanged is recorded when user changes email of the account
+	EventEmailChanged = "email_changed"
+	// EventPasswordChanged is recorded when user changes password knowing the current one
+	EventPasswordChanged = "password_changed"
+	// EventAccountDeleted is recorded when user deletes the account and its personal data is erased
+	EventAccountDeleted = "account_deleted"
+	// EventIdentityLinked is recorded when identity of external provider is linked to the account
+	EventIdentityLinked = "identity_linked"
+)
+
+// Event represents security relevant action of the user
+type Event struct {
+	Type     string
+	UserUUID string
+	Email    string
+	PeerAddr string
+	// Actor is subject of the principal who performed the action on behalf of the user
+	Actor  string
+	Reason string
+}
+
+// Logger writes audit events as json lines, it is separate from service log
+// so audit trail can be shipped and retained on its own
+type Logger struct {
+	logger *log.Logger
+}
+
+// NewLogger return new Logger instance which writes events into out
+func NewLogger(out io.Writer) *Logger {
+	logger := log.New()
+	logger.SetOutput(out)
+	logger.SetFormatter(&log.JSONFormatter{})
+	return &Logger{logger: logger}
+}
+
+// Record write event, request id is taken from request scoped logger of ctx
+func (l *Logger) Record(ctx context.Context, event *Event) {
+	fields := log.Fields{
+		"event":    event.Type,
+		"userID":   event.UserUUID,
+		"email":    event.Email,
+		"peerAddr": event.PeerAddr,
+	}
+	if event.Actor != "" {
+		fields["actor"] = event.Actor
+	}
+	if event.Reason != "" {
+		fields["reason"] = event.Reason
+	}
+	if requestID, ok := logging.FromContext(ctx).Data["requestID"]; ok {
+		fields["requestID"] = requestID
+	}
+	l.logger.WithFields(fields).Info("auth audit")
+}
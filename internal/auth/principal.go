@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// AuthMethodMTLS marks principals identified by verified client certificate
+	AuthMethodMTLS = "mtls"
+	// AuthMethodJWT marks principals identified by access token
+	AuthMethodJWT = "jwt"
+	// AuthMethodAPIKey marks principals identified by api key of service client
+	AuthMethodAPIKey = "apikey"
+
+	// RoleAdmin is granted to users which manage other users
+	RoleAdmin = "admin"
+
+	// ScopeOrdersRead allows reading orders
+	ScopeOrdersRead = "orders:read"
+	// ScopeOrdersWrite allows creating, updating and deleting orders
+	ScopeOrdersWrite = "orders:write"
+)
+
+// UserScopes are granted to tokens issued on user authentication
+var UserScopes = []string{ScopeOrdersRead, ScopeOrdersWrite}
+
+// Principal represents identity of the caller, Subject is user uuid for
+// token principals and certificate name for mutual tls principals
+type Principal struct {
+	Subject    string
+	UserID     string
+	Email      string
+	Roles      []string
+	Scopes     []string
+	SessionID  string
+	TokenID    string
+	IssuedAt   time.Time
+	AuthMethod string
+}
+
+// HasRole checks whether principal was granted role
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope checks whether principal was granted scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// NewContext returns copy of ctx which carries principal
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns principal stored in ctx
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
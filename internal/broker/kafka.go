@@ -1,10 +1,15 @@
 package broker
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/metrics"
 	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
 	"github.com/segmentio/kafka-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // KafkaClient represent kafka client structure
@@ -27,8 +32,16 @@ func NewKafkaReader(reader *kafka.Reader) *KafkaReader {
 	return &KafkaReader{Reader: reader}
 }
 
-// PublishMessage send message to kafka queue
-func (kCli *KafkaClient) PublishMessage(method string, order *model.Order) error {
+// PublishMessage send message to kafka queue, trace context from ctx is passed in message headers
+func (kCli *KafkaClient) PublishMessage(ctx context.Context, method string, order *model.Order) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "kafka publish", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingDestinationKindTopic))
+	defer func() {
+		metrics.ObservePublish("kafka", err)
+		tracing.EndSpan(span, err)
+	}()
 	message := model.OrderMessage{
 		Method: method,
 		Data:   order,
@@ -37,7 +50,28 @@ func (kCli *KafkaClient) PublishMessage(method string, order *model.Order) error
 	if err != nil {
 		return fmt.Errorf("kafka: publishing failed - %e", err)
 	}
+	var headers []kafka.Header
+	tracing.Inject(ctx, tracing.KafkaHeadersCarrier{Headers: &headers})
 	_, err = kCli.Connection.WriteMessages(
-		kafka.Message{Value: []byte(msg)})
+		kafka.Message{Value: []byte(msg), Headers: headers})
+	if err != nil {
+		return fmt.Errorf("kafka: publishing failed - %w", err)
+	}
+	return nil
+}
+
+// Close method close kafka writer connection
+func (kCli *KafkaClient) Close() error {
+	if err := kCli.Connection.Close(); err != nil {
+		return fmt.Errorf("kafka: error while closing connection - %w", err)
+	}
+	return nil
+}
+
+// Close method close kafka reader
+func (kReader *KafkaReader) Close() error {
+	if err := kReader.Reader.Close(); err != nil {
+		return fmt.Errorf("kafka: error while closing reader - %w", err)
+	}
 	return nil
 }
@@ -1,25 +1,44 @@
 package broker
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/metrics"
 	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
 	"github.com/streadway/amqp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// RabbitClient represent rabbitmq client structure
+// RevocationConsumerTag identifies consumer of token revocations on rabbitmq channel
+const RevocationConsumerTag = "token-revocations"
+
+// RabbitClient represent rabbitmq client structure, RevocationExchange is fanout exchange
+// which delivers token revocations to every service replica
 type RabbitClient struct {
-	Channel *amqp.Channel
-	Queue   *amqp.Queue
+	Channel            *amqp.Channel
+	Queue              *amqp.Queue
+	RevocationExchange string
 }
 
 // NewRabbit return new RabbitClient instance
-func NewRabbit(channel *amqp.Channel, queue *amqp.Queue) *RabbitClient {
-	return &RabbitClient{Channel: channel, Queue: queue}
+func NewRabbit(channel *amqp.Channel, queue *amqp.Queue, revocationExchange string) *RabbitClient {
+	return &RabbitClient{Channel: channel, Queue: queue, RevocationExchange: revocationExchange}
 }
 
-// PublishMessage send message to rabbitmq queue
-func (rCli *RabbitClient) PublishMessage(method string, order *model.Order) error {
+// PublishMessage send message to rabbitmq queue, trace context from ctx is passed in message headers
+func (rCli *RabbitClient) PublishMessage(ctx context.Context, method string, order *model.Order) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "rabbitmq publish", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("rabbitmq"),
+			semconv.MessagingDestinationKindQueue,
+			semconv.MessagingDestinationKey.String(rCli.Queue.Name)))
+	defer func() {
+		metrics.ObservePublish("rabbitmq", err)
+		tracing.EndSpan(span, err)
+	}()
 	message := model.OrderMessage{
 		Method: method,
 		Data:   order,
@@ -28,8 +47,11 @@ func (rCli *RabbitClient) PublishMessage(method string, order *model.Order) erro
 	if err != nil {
 		return fmt.Errorf("rabbitmq: publishing failed - %e", err)
 	}
+	headers := amqp.Table{}
+	tracing.Inject(ctx, tracing.AMQPHeadersCarrier(headers))
 	err = rCli.Channel.Publish("", rCli.Queue.Name, false, false,
 		amqp.Publishing{
+			Headers:     headers,
 			ContentType: "text/plain",
 			Body:        []byte(msg)})
 	if err != nil {
@@ -37,3 +59,57 @@ func (rCli *RabbitClient) PublishMessage(method string, order *model.Order) erro
 	}
 	return nil
 }
+
+// PublishRevocation send access token revocation to all service replicas
+func (rCli *RabbitClient) PublishRevocation(ctx context.Context, revocation *model.Revocation) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "rabbitmq publish", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("rabbitmq"),
+			semconv.MessagingDestinationKindTopic,
+			semconv.MessagingDestinationKey.String(rCli.RevocationExchange)))
+	defer func() {
+		metrics.ObservePublish("rabbitmq", err)
+		tracing.EndSpan(span, err)
+	}()
+	msg, err := json.Marshal(revocation)
+	if err != nil {
+		return fmt.Errorf("rabbitmq: publishing failed - %w", err)
+	}
+	headers := amqp.Table{}
+	tracing.Inject(ctx, tracing.AMQPHeadersCarrier(headers))
+	err = rCli.Channel.Publish(rCli.RevocationExchange, "", false, false,
+		amqp.Publishing{
+			Headers:     headers,
+			ContentType: "application/json",
+			Body:        msg})
+	if err != nil {
+		return fmt.Errorf("rabbitmq: publishing failed - %w", err)
+	}
+	return nil
+}
+
+// ConsumeRevocations start consuming token revocations on channel through exclusive queue of this
+// replica bound to revocation exchange, the queue is deleted when consumer stops. Channel should be
+// used only by this consumer, so errors of publishers don't stop it
+func (rCli *RabbitClient) ConsumeRevocations(channel *amqp.Channel) (<-chan amqp.Delivery, error) {
+	q, err := channel.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("rabbitmq: error while creating revocations queue - %w", err)
+	}
+	if err := channel.QueueBind(q.Name, "", rCli.RevocationExchange, false, nil); err != nil {
+		return nil, fmt.Errorf("rabbitmq: error while binding revocations queue - %w", err)
+	}
+	msgs, err := channel.Consume(q.Name, RevocationConsumerTag, true, true, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("rabbitmq: error while consuming revocations - %w", err)
+	}
+	return msgs, nil
+}
+
+// Close method close rabbitmq channel
+func (rCli *RabbitClient) Close() error {
+	if err := rCli.Channel.Close(); err != nil {
+		return fmt.Errorf("rabbitmq: error while closing channel - %w", err)
+	}
+	return nil
+}
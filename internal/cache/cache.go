@@ -2,126 +2,37 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"github.com/EgorBessonov/gRPC/internal/broker"
 	"github.com/EgorBessonov/gRPC/internal/model"
-	log "github.com/sirupsen/logrus"
-	"sync"
 )
 
-// OrderCache represent cache structure
-type OrderCache struct {
-	orders      map[string]*model.Order
-	rabbitCli   *broker.RabbitClient
-	kafkaReader *broker.KafkaReader
-	kafkaCli    *broker.KafkaClient
-	mutex       sync.Mutex
-}
-
-// NewCache return new cache instance and run kafka & rabbitmq consumers
-func NewCache(ctx context.Context, kafkaCli *broker.KafkaClient, kafkaReader *broker.KafkaReader, rabbitQueueName string, rabbitCli *broker.RabbitClient) *OrderCache {
-	var cache OrderCache
-	cache.orders = make(map[string]*model.Order)
-	cache.rabbitCli = rabbitCli
-	cache.kafkaCli = kafkaCli
-	cache.kafkaReader = kafkaReader
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				msgs, err := rabbitCli.Channel.Consume(
-					rabbitQueueName,
-					"",
-					true,
-					false,
-					false,
-					false,
-					nil)
-				if err != nil {
-					log.Errorf("rabbitmq consumer: %e", err)
-				}
-				for d := range msgs {
-					message := model.OrderMessage{}
-					if err := json.Unmarshal(d.Body, &message); err != nil {
-						log.Errorf("rabbitmq consumer: error while parsing message - %e", err)
-					}
-					if message.Method != "" {
-						err = cache.brokerHandler(message.Method, message.Data)
-						if err != nil {
-							log.Errorf("rebbitmq handler: %e", err)
-						}
-					}
-				}
-			}
-		}
-	}()
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				msg, err := kafkaReader.Reader.ReadMessage(context.Background())
-				if err != nil {
-					log.Errorf("kafka consumer: %e", err)
-				}
-				if msg.Value != nil {
-					message := model.OrderMessage{}
-					err = json.Unmarshal(msg.Value, &message)
-					if err != nil {
-						log.Errorf("kafka consumer: error while parsing message - %e", err)
-					}
-					if message.Method != "" {
-						err := cache.brokerHandler(message.Method, message.Data)
-						if err != nil {
-							log.Errorf("kafka handler: %e", err)
-						}
-					}
-				}
-			}
-		}
-	}()
-	return &cache
-}
-
-//Get method return order object from cache or take it from repository
-func (orderCache *OrderCache) Get(orderID string) (*model.Order, bool) {
-	orderCache.mutex.Lock()
-	defer orderCache.mutex.Unlock()
-	order, found := orderCache.orders[orderID]
-	return order, found
-}
+const (
+	// BackendMemory keeps orders in memory of every service replica
+	BackendMemory = "memory"
+	// BackendRedis keeps orders in redis shared by service replicas
+	BackendRedis = "redis"
 
-//Save method send message to rabbit/kafka queue for saving order
-func (orderCache *OrderCache) Save(order *model.Order) error {
-	return orderCache.rabbitCli.PublishMessage("save", order)
-}
-
-// Update method send message to rabbit/kafka queue stream for updating order
-func (orderCache *OrderCache) Update(order *model.Order) error {
-	return orderCache.rabbitCli.PublishMessage("update", order)
-}
+	methodSave   = "save"
+	methodUpdate = "update"
+	methodDelete = "delete"
+)
 
-// Delete method send message to rabbit/kafka queue for removing order
-func (orderCache *OrderCache) Delete(orderID string) error {
-	return orderCache.rabbitCli.PublishMessage("delete", &model.Order{OrderID: orderID})
+// Publisher sends order changes to brokers, cache consumers of every replica apply them
+type Publisher interface {
+	PublishMessage(ctx context.Context, method string, order *model.Order) error
 }
 
-// brokerHandler handle messages from broker
-func (orderCache *OrderCache) brokerHandler(method string, order *model.Order) error {
-	orderCache.mutex.Lock()
-	defer orderCache.mutex.Unlock()
-	switch method {
-	case "save", "update":
-		orderCache.orders[order.OrderID] = order
-		return nil
-	case "delete":
-		delete(orderCache.orders, order.OrderID)
-		return nil
-	default:
-		return fmt.Errorf("cache handler: invalid method type")
-	}
+// OrderCache interface represent order cache behavior. Changes are sent to brokers and applied to cache
+// by broker consumers, while Fill puts order read from repository directly. Version counts changes of
+// the order applied by consumers, Fill skips order when it was changed after version was taken, so order
+// read from repository before concurrent update or delete doesn't replace newer one
+type OrderCache interface {
+	Get(ctx context.Context, orderID string) (*model.Order, bool)
+	Version(ctx context.Context, orderID string) uint64
+	Fill(ctx context.Context, order *model.Order, version uint64)
+	Save(ctx context.Context, order *model.Order) error
+	Update(ctx context.Context, order *model.Order) error
+	Delete(ctx context.Context, orderID string) error
+	// Drain waits until broker consumers handle already received messages and stop and releases
+	// cache resources, it should be called after cancelling the context passed to Consume
+	Drain(ctx context.Context) error
 }
@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/broker"
+	"github.com/EgorBessonov/gRPC/internal/metrics"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
+	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"time"
+)
+
+const (
+	rabbitConsumerTag  = "order-cache"
+	consumerRetryDelay = time.Second
+	// maxBatchSize limits number of already received rabbitmq messages applied to cache at once
+	maxBatchSize = 100
+)
+
+// applyFunc applies batch of valid broker messages to cache
+type applyFunc func(ctx context.Context, messages []model.OrderMessage) error
+
+// delivery is broker message with headers which carry trace context of publisher
+type delivery struct {
+	headers propagation.TextMapCarrier
+	body    []byte
+}
+
+// consumers read order messages from kafka & rabbitmq and pass them to cache
+type consumers struct {
+	rabbitCli   *broker.RabbitClient
+	kafkaReader *broker.KafkaReader
+	apply       applyFunc
+	running     sync.WaitGroup
+}
+
+// startConsumers run kafka & rabbitmq consumers which stop when ctx is cancelled
+func startConsumers(ctx context.Context, kafkaReader *broker.KafkaReader, rabbitQueueName string, rabbitCli *broker.RabbitClient, apply applyFunc) *consumers {
+	c := &consumers{
+		rabbitCli:   rabbitCli,
+		kafkaReader: kafkaReader,
+		apply:       apply,
+	}
+	c.running.Add(2)
+	go c.consumeRabbit(ctx, rabbitQueueName)
+	go c.consumeKafka(ctx)
+	return c
+}
+
+// drain waits until consumers handle already received messages and stop, it returns at once
+// when consumers weren't started
+func (c *consumers) drain(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		c.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("cache: consumers drain failed - %w", ctx.Err())
+	}
+}
+
+// consumeRabbit read messages from rabbitmq queue until ctx is cancelled
+func (c *consumers) consumeRabbit(ctx context.Context, rabbitQueueName string) {
+	defer c.running.Done()
+	for {
+		msgs, err := c.rabbitCli.Channel.Consume(
+			rabbitQueueName,
+			rabbitConsumerTag,
+			true,
+			false,
+			false,
+			false,
+			nil)
+		if err != nil {
+			log.Errorf("rabbitmq consumer: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(consumerRetryDelay):
+				continue
+			}
+		}
+		if !c.handleDeliveries(ctx, msgs) {
+			return
+		}
+	}
+}
+
+// handleDeliveries handle rabbitmq deliveries, messages which are already received are handled together.
+// It returns false when consumer was stopped by ctx and true when deliveries channel was closed by broker
+func (c *consumers) handleDeliveries(ctx context.Context, msgs <-chan amqp.Delivery) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			if err := c.rabbitCli.Channel.Cancel(rabbitConsumerTag, false); err != nil {
+				log.Errorf("rabbitmq consumer: error while cancelling consumer - %v", err)
+				return false
+			}
+			// deliveries are auto acked, so messages which are already received must be handled
+			var batch []delivery
+			for d := range msgs {
+				batch = append(batch, delivery{headers: tracing.AMQPHeadersCarrier(d.Headers), body: d.Body})
+			}
+			c.handleMessages("rabbitmq", batch)
+			return false
+		case d, ok := <-msgs:
+			if !ok {
+				return true
+			}
+			batch := []delivery{{headers: tracing.AMQPHeadersCarrier(d.Headers), body: d.Body}}
+			closed := false
+		collect:
+			for len(batch) < maxBatchSize {
+				select {
+				case d, ok := <-msgs:
+					if !ok {
+						closed = true
+						break collect
+					}
+					batch = append(batch, delivery{headers: tracing.AMQPHeadersCarrier(d.Headers), body: d.Body})
+				default:
+					break collect
+				}
+			}
+			c.handleMessages("rabbitmq", batch)
+			if closed {
+				return true
+			}
+		}
+	}
+}
+
+// consumeKafka read messages from kafka topic until ctx is cancelled
+func (c *consumers) consumeKafka(ctx context.Context) {
+	defer c.running.Done()
+	for {
+		msg, err := c.kafkaReader.Reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Errorf("kafka consumer: %v", err)
+			continue
+		}
+		if msg.Value != nil {
+			c.handleMessages("kafka", []delivery{{headers: tracing.KafkaHeadersCarrier{Headers: &msg.Headers}, body: msg.Value}})
+		}
+	}
+}
+
+// handleMessages parse broker messages and apply valid ones to cache, span of every message processing
+// continues trace passed by publisher in message headers
+func (c *consumers) handleMessages(brokerName string, batch []delivery) {
+	if len(batch) == 0 {
+		return
+	}
+	spans := make([]trace.Span, 0, len(batch))
+	messages := make([]model.OrderMessage, 0, len(batch))
+	for _, d := range batch {
+		ctx := tracing.Extract(context.Background(), d.headers)
+		_, span := tracing.Tracer().Start(ctx, brokerName+" process", trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				semconv.MessagingSystemKey.String(brokerName),
+				semconv.MessagingOperationProcess))
+		message, err := parseMessage(d.body)
+		if err != nil {
+			metrics.ConsumerErrors.WithLabelValues(brokerName).Inc()
+			log.Errorf("%s consumer: %v", brokerName, err)
+			tracing.EndSpan(span, err)
+			continue
+		}
+		if message.Method == "" {
+			tracing.EndSpan(span, nil)
+			continue
+		}
+		spans = append(spans, span)
+		messages = append(messages, message)
+	}
+	if len(messages) == 0 {
+		return
+	}
+	err := c.apply(context.Background(), messages)
+	if err != nil {
+		metrics.ConsumerErrors.WithLabelValues(brokerName).Add(float64(len(messages)))
+		log.Errorf("%s handler: %v", brokerName, err)
+	}
+	for _, span := range spans {
+		tracing.EndSpan(span, err)
+	}
+}
+
+// parseMessage decode broker message, messages without method are skipped by consumers
+func parseMessage(body []byte) (model.OrderMessage, error) {
+	message := model.OrderMessage{}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return message, fmt.Errorf("error while parsing message - %w", err)
+	}
+	if message.Method == "" {
+		return message, nil
+	}
+	switch message.Method {
+	case methodSave, methodUpdate, methodDelete:
+	default:
+		return message, fmt.Errorf("invalid method type %q", message.Method)
+	}
+	if message.Data == nil {
+		return message, fmt.Errorf("message without order")
+	}
+	return message, nil
+}
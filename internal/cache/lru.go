@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"container/list"
+	"github.com/EgorBessonov/gRPC/internal/metrics"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"time"
+)
+
+// entryOverhead approximates memory taken by one cached order besides its strings: order
+// struct, list element, map bucket slot and entry struct
+const entryOverhead = 256
+
+// Options struct represents cache limits, zero values mean no limit
+type Options struct {
+	// MaxEntries limits number of cached orders
+	MaxEntries int
+	// MaxBytes limits approximate memory taken by cached orders
+	MaxBytes int64
+	// TTL is time after which cached order is dropped even if it is read
+	TTL time.Duration
+}
+
+type lruEntry struct {
+	order     *model.Order
+	size      int64
+	expiresAt time.Time
+}
+
+// lru keeps orders in least recently used order and evicts the oldest ones when limits are
+// exceeded, it isn't safe for concurrent use
+type lru struct {
+	opts     Options
+	items    map[string]*list.Element
+	recency  *list.List
+	curBytes int64
+}
+
+func newLRU(opts Options) *lru {
+	return &lru{
+		opts:    opts,
+		items:   make(map[string]*list.Element),
+		recency: list.New(),
+	}
+}
+
+// get return order and mark it as recently used, expired order is removed and reported as missing
+func (c *lru) get(orderID string, now time.Time) (*model.Order, bool) {
+	element, found := c.items[orderID]
+	if !found {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if c.expired(entry, now) {
+		c.removeElement(element)
+		metrics.CacheExpirations.Inc()
+		return nil, false
+	}
+	c.recency.MoveToFront(element)
+	return entry.order, true
+}
+
+// set add or replace order and evict least recently used orders which don't fit into limits
+func (c *lru) set(order *model.Order, now time.Time) {
+	entry := &lruEntry{order: order, size: orderSize(order)}
+	if c.opts.TTL > 0 {
+		entry.expiresAt = now.Add(c.opts.TTL)
+	}
+	if element, found := c.items[order.OrderID]; found {
+		c.curBytes -= element.Value.(*lruEntry).size
+		element.Value = entry
+		c.recency.MoveToFront(element)
+	} else {
+		c.items[order.OrderID] = c.recency.PushFront(entry)
+	}
+	c.curBytes += entry.size
+	for c.overflow() {
+		oldest := c.recency.Back()
+		if c.expired(oldest.Value.(*lruEntry), now) {
+			metrics.CacheExpirations.Inc()
+		} else {
+			metrics.CacheEvictions.Inc()
+		}
+		c.removeElement(oldest)
+	}
+}
+
+// remove drop order from cache if it is there
+func (c *lru) remove(orderID string) {
+	if element, found := c.items[orderID]; found {
+		c.removeElement(element)
+	}
+}
+
+func (c *lru) len() int {
+	return len(c.items)
+}
+
+// overflow checks whether cache exceeds limits, the last added order is always kept
+func (c *lru) overflow() bool {
+	if c.recency.Len() <= 1 {
+		return false
+	}
+	return (c.opts.MaxEntries > 0 && c.recency.Len() > c.opts.MaxEntries) ||
+		(c.opts.MaxBytes > 0 && c.curBytes > c.opts.MaxBytes)
+}
+
+func (c *lru) expired(entry *lruEntry, now time.Time) bool {
+	return !entry.expiresAt.IsZero() && !now.Before(entry.expiresAt)
+}
+
+func (c *lru) removeElement(element *list.Element) {
+	entry := c.recency.Remove(element).(*lruEntry)
+	delete(c.items, entry.order.OrderID)
+	c.curBytes -= entry.size
+}
+
+// orderSize approximates memory taken by cached order
+func orderSize(order *model.Order) int64 {
+	return int64(len(order.OrderID)+len(order.OrderName)+len(order.OwnerUUID)) + entryOverhead
+}
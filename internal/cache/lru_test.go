@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	order := func(id string) *model.Order {
+		return &model.Order{OrderID: id, OrderName: "order"}
+	}
+	tests := []struct {
+		name string
+		opts Options
+		// run fills cache, now is shared with checks
+		run       func(c *lru, now *time.Time)
+		wantFound []string
+		wantGone  []string
+	}{
+		{
+			name: "no limits",
+			run: func(c *lru, now *time.Time) {
+				c.set(order("1"), *now)
+				c.set(order("2"), *now)
+			},
+			wantFound: []string{"1", "2"},
+		},
+		{
+			name: "max entries evicts least recently used",
+			opts: Options{MaxEntries: 2},
+			run: func(c *lru, now *time.Time) {
+				c.set(order("1"), *now)
+				c.set(order("2"), *now)
+				c.get("1", *now)
+				c.set(order("3"), *now)
+			},
+			wantFound: []string{"1", "3"},
+			wantGone:  []string{"2"},
+		},
+		{
+			name: "max bytes evicts least recently used",
+			opts: Options{MaxBytes: 2 * orderSize(order("1"))},
+			run: func(c *lru, now *time.Time) {
+				c.set(order("1"), *now)
+				c.set(order("2"), *now)
+				c.set(order("3"), *now)
+			},
+			wantFound: []string{"2", "3"},
+			wantGone:  []string{"1"},
+		},
+		{
+			name: "last added order is kept",
+			opts: Options{MaxBytes: 1},
+			run: func(c *lru, now *time.Time) {
+				c.set(order("1"), *now)
+				c.set(order("2"), *now)
+			},
+			wantFound: []string{"2"},
+			wantGone:  []string{"1"},
+		},
+		{
+			name: "replace keeps one entry",
+			opts: Options{MaxEntries: 2},
+			run: func(c *lru, now *time.Time) {
+				c.set(order("1"), *now)
+				c.set(order("2"), *now)
+				c.set(order("1"), *now)
+				c.set(order("3"), *now)
+			},
+			wantFound: []string{"1", "3"},
+			wantGone:  []string{"2"},
+		},
+		{
+			name: "ttl expires orders even if they are read",
+			opts: Options{TTL: time.Minute},
+			run: func(c *lru, now *time.Time) {
+				c.set(order("1"), *now)
+				*now = now.Add(30 * time.Second)
+				c.get("1", *now)
+				c.set(order("2"), *now)
+				*now = now.Add(30 * time.Second)
+			},
+			wantFound: []string{"2"},
+			wantGone:  []string{"1"},
+		},
+		{
+			name: "remove",
+			run: func(c *lru, now *time.Time) {
+				c.set(order("1"), *now)
+				c.set(order("2"), *now)
+				c.remove("1")
+				c.remove("missing")
+			},
+			wantFound: []string{"2"},
+			wantGone:  []string{"1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1600000000, 0)
+			c := newLRU(tt.opts)
+			tt.run(c, &now)
+			for _, orderID := range tt.wantFound {
+				if _, found := c.get(orderID, now); !found {
+					t.Errorf("get(%s) didn't find order", orderID)
+				}
+			}
+			for _, orderID := range tt.wantGone {
+				if got, found := c.get(orderID, now); found {
+					t.Errorf("get(%s) = %+v, want missing order", orderID, got)
+				}
+			}
+			if c.len() != len(tt.wantFound) {
+				t.Errorf("len() = %d, want %d", c.len(), len(tt.wantFound))
+			}
+			var wantBytes int64
+			for _, orderID := range tt.wantFound {
+				wantBytes += orderSize(order(orderID))
+			}
+			if c.curBytes != wantBytes {
+				t.Errorf("curBytes = %d, want %d", c.curBytes, wantBytes)
+			}
+		})
+	}
+}
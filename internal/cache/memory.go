@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/broker"
+	"github.com/EgorBessonov/gRPC/internal/metrics"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// versionStripes is number of change counters shared by orders, orders with the same counter
+// only skip fills of each other, so memory doesn't grow with number of orders
+const versionStripes = 1024
+
+// MemoryCache represent in-memory cache structure, orders are kept within limits of Options
+type MemoryCache struct {
+	orders    *lru
+	versions  [versionStripes]uint64
+	publisher Publisher
+	mutex     sync.Mutex
+	consumers *consumers
+}
+
+// NewCache return new in-memory cache instance, changes are sent by publisher and applied
+// to cache after Consume is called
+func NewCache(publisher Publisher, opts Options) *MemoryCache {
+	return &MemoryCache{
+		orders:    newLRU(opts),
+		publisher: publisher,
+	}
+}
+
+// Consume method run kafka & rabbitmq consumers which apply received changes to cache,
+// consumers stop when ctx is cancelled
+func (orderCache *MemoryCache) Consume(ctx context.Context, kafkaReader *broker.KafkaReader, rabbitQueueName string, rabbitCli *broker.RabbitClient) {
+	orderCache.consumers = startConsumers(ctx, kafkaReader, rabbitQueueName, rabbitCli, orderCache.apply)
+}
+
+// Drain method waits until broker consumers handle already received messages and stop,
+// it should be called after cancelling the context passed to Consume
+func (orderCache *MemoryCache) Drain(ctx context.Context) error {
+	return orderCache.consumers.drain(ctx)
+}
+
+// Get method return order object from cache or take it from repository
+func (orderCache *MemoryCache) Get(_ context.Context, orderID string) (*model.Order, bool) {
+	orderCache.mutex.Lock()
+	defer orderCache.mutex.Unlock()
+	order, found := orderCache.orders.get(orderID, time.Now())
+	// expired order is dropped on read
+	metrics.CacheSize.Set(float64(orderCache.orders.len()))
+	if found {
+		metrics.CacheHits.Inc()
+	} else {
+		metrics.CacheMisses.Inc()
+	}
+	return order, found
+}
+
+// Version method return change counter of the order
+func (orderCache *MemoryCache) Version(_ context.Context, orderID string) uint64 {
+	orderCache.mutex.Lock()
+	defer orderCache.mutex.Unlock()
+	return orderCache.versions[versionStripe(orderID)]
+}
+
+// Fill method put order read from repository into local cache unless it was changed after version, unlike
+// Save it doesn't send messages to brokers, so other replicas and consumers don't see it as a new order
+func (orderCache *MemoryCache) Fill(_ context.Context, order *model.Order, version uint64) {
+	orderCache.mutex.Lock()
+	defer orderCache.mutex.Unlock()
+	if orderCache.versions[versionStripe(order.OrderID)] != version {
+		return
+	}
+	orderCache.orders.set(order, time.Now())
+	metrics.CacheSize.Set(float64(orderCache.orders.len()))
+}
+
+// Save method send message to rabbit/kafka queue for saving order
+func (orderCache *MemoryCache) Save(ctx context.Context, order *model.Order) error {
+	return orderCache.publisher.PublishMessage(ctx, methodSave, order)
+}
+
+// Update method send message to rabbit/kafka queue stream for updating order
+func (orderCache *MemoryCache) Update(ctx context.Context, order *model.Order) error {
+	return orderCache.publisher.PublishMessage(ctx, methodUpdate, order)
+}
+
+// Delete method send message to rabbit/kafka queue for removing order
+func (orderCache *MemoryCache) Delete(ctx context.Context, orderID string) error {
+	return orderCache.publisher.PublishMessage(ctx, methodDelete, &model.Order{OrderID: orderID})
+}
+
+// apply handle batch of broker messages
+func (orderCache *MemoryCache) apply(_ context.Context, messages []model.OrderMessage) error {
+	for _, message := range messages {
+		if err := orderCache.brokerHandler(message.Method, message.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// brokerHandler handle messages from broker
+func (orderCache *MemoryCache) brokerHandler(method string, order *model.Order) error {
+	orderCache.mutex.Lock()
+	defer orderCache.mutex.Unlock()
+	defer func() {
+		metrics.CacheSize.Set(float64(orderCache.orders.len()))
+	}()
+	orderCache.versions[versionStripe(order.OrderID)]++
+	switch method {
+	case methodSave, methodUpdate:
+		orderCache.orders.set(order, time.Now())
+		return nil
+	case methodDelete:
+		orderCache.orders.remove(order.OrderID)
+		return nil
+	default:
+		return fmt.Errorf("cache handler: invalid method type")
+	}
+}
+
+// versionStripe return index of change counter of the order
+func versionStripe(orderID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(orderID))
+	return int(h.Sum32() % versionStripes)
+}
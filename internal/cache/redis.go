@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/broker"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/metrics"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/go-redis/redis/v8"
+	"math"
+	"time"
+)
+
+// versionTTL is time for which change counter of the order is kept after the last change, it must be
+// longer than repository reads of orders which are put into cache
+const versionTTL = time.Minute
+
+// fillScript sets order unless its change counter differs from expected version, missing counter is 0
+var fillScript = redis.NewScript(`
+if (redis.call("get", KEYS[2]) or "0") ~= ARGV[1] then
+	return 0
+end
+if ARGV[3] == "0" then
+	redis.call("set", KEYS[1], ARGV[2])
+else
+	redis.call("set", KEYS[1], ARGV[2], "px", ARGV[3])
+end
+return 1
+`)
+
+// RedisCache represent cache structure which keeps orders in redis, so cached orders are shared by
+// service replicas. Orders are stored as json under keyPrefix+orderID and expire after ttl, change
+// counters of orders are stored under keyPrefix+"version:"+orderID
+type RedisCache struct {
+	client    redis.UniversalClient
+	publisher Publisher
+	keyPrefix string
+	ttl       time.Duration
+	consumers *consumers
+}
+
+// NewRedisCache return new redis cache instance, changes are sent by publisher and written into redis
+// after Consume is called. Zero ttl means orders don't expire
+func NewRedisCache(client redis.UniversalClient, publisher Publisher, keyPrefix string, ttl time.Duration) *RedisCache {
+	return &RedisCache{
+		client:    client,
+		publisher: publisher,
+		keyPrefix: keyPrefix,
+		ttl:       ttl,
+	}
+}
+
+// Consume method run kafka & rabbitmq consumers which write received changes into redis,
+// consumers stop when ctx is cancelled
+func (orderCache *RedisCache) Consume(ctx context.Context, kafkaReader *broker.KafkaReader, rabbitQueueName string, rabbitCli *broker.RabbitClient) {
+	orderCache.consumers = startConsumers(ctx, kafkaReader, rabbitQueueName, rabbitCli, orderCache.apply)
+}
+
+// Drain method waits until broker consumers handle already received messages and stop, redis
+// connections are closed after that
+func (orderCache *RedisCache) Drain(ctx context.Context) error {
+	err := orderCache.consumers.drain(ctx)
+	if closeErr := orderCache.client.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("cache: can't close redis client - %w", closeErr)
+	}
+	return err
+}
+
+// Get method return order object from redis, redis failures are reported as cache miss,
+// so orders are read from repository while redis is unavailable
+func (orderCache *RedisCache) Get(ctx context.Context, orderID string) (*model.Order, bool) {
+	data, err := orderCache.client.Get(ctx, orderCache.key(orderID)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			logging.FromContext(ctx).Errorf("cache: can't get order from redis - %v", err)
+		}
+		metrics.CacheMisses.Inc()
+		return nil, false
+	}
+	order := &model.Order{}
+	if err := order.UnmarshalBinary(data); err != nil {
+		logging.FromContext(ctx).Errorf("cache: can't decode order from redis - %v", err)
+		metrics.CacheMisses.Inc()
+		return nil, false
+	}
+	metrics.CacheHits.Inc()
+	return order, true
+}
+
+// Version method return change counter of the order, redis failures are reported as the counter which
+// never matches, so order isn't put into cache
+func (orderCache *RedisCache) Version(ctx context.Context, orderID string) uint64 {
+	version, err := orderCache.client.Get(ctx, orderCache.versionKey(orderID)).Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("cache: can't get order version from redis - %v", err)
+		return math.MaxUint64
+	}
+	return version
+}
+
+// Fill method put order read from repository into redis unless it was changed after version, unlike
+// Save it doesn't send messages to brokers, so consumers don't see it as a new order
+func (orderCache *RedisCache) Fill(ctx context.Context, order *model.Order, version uint64) {
+	data, err := order.MarshalBinary()
+	if err != nil {
+		logging.FromContext(ctx).Errorf("cache: can't encode order - %v", err)
+		return
+	}
+	keys := []string{orderCache.key(order.OrderID), orderCache.versionKey(order.OrderID)}
+	err = fillScript.Run(ctx, orderCache.client, keys, version, data, orderCache.ttl.Milliseconds()).Err()
+	if err != nil {
+		logging.FromContext(ctx).Errorf("cache: can't put order into redis - %v", err)
+	}
+}
+
+// Save method send message to rabbit/kafka queue for saving order
+func (orderCache *RedisCache) Save(ctx context.Context, order *model.Order) error {
+	return orderCache.publisher.PublishMessage(ctx, methodSave, order)
+}
+
+// Update method send message to rabbit/kafka queue stream for updating order
+func (orderCache *RedisCache) Update(ctx context.Context, order *model.Order) error {
+	return orderCache.publisher.PublishMessage(ctx, methodUpdate, order)
+}
+
+// Delete method send message to rabbit/kafka queue for removing order
+func (orderCache *RedisCache) Delete(ctx context.Context, orderID string) error {
+	return orderCache.publisher.PublishMessage(ctx, methodDelete, &model.Order{OrderID: orderID})
+}
+
+// apply write batch of broker messages into redis with single pipeline round trip
+func (orderCache *RedisCache) apply(ctx context.Context, messages []model.OrderMessage) error {
+	_, err := orderCache.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, message := range messages {
+			switch message.Method {
+			case methodSave, methodUpdate:
+				pipe.Set(ctx, orderCache.key(message.Data.OrderID), message.Data, orderCache.ttl)
+			case methodDelete:
+				pipe.Del(ctx, orderCache.key(message.Data.OrderID))
+			}
+			pipe.Incr(ctx, orderCache.versionKey(message.Data.OrderID))
+			pipe.PExpire(ctx, orderCache.versionKey(message.Data.OrderID), versionTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cache handler: redis pipeline failed - %w", err)
+	}
+	return nil
+}
+
+func (orderCache *RedisCache) key(orderID string) string {
+	return orderCache.keyPrefix + orderID
+}
+
+func (orderCache *RedisCache) versionKey(orderID string) string {
+	return orderCache.keyPrefix + "version:" + orderID
+}
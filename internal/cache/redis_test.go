@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"testing"
+	"time"
+)
+
+// fakePublisher keeps published messages instead of sending them to brokers
+type fakePublisher struct {
+	messages []model.OrderMessage
+}
+
+func (p *fakePublisher) PublishMessage(_ context.Context, method string, order *model.Order) error {
+	p.messages = append(p.messages, model.OrderMessage{Method: method, Data: order})
+	return nil
+}
+
+func newTestRedisCache(t *testing.T, ttl time.Duration) (*RedisCache, *miniredis.Miniredis, *fakePublisher) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	publisher := &fakePublisher{}
+	return NewRedisCache(client, publisher, "order:", ttl), server, publisher
+}
+
+func TestRedisCacheGetAndFill(t *testing.T) {
+	orderCache, server, _ := newTestRedisCache(t, 0)
+	ctx := context.Background()
+	order := &model.Order{OrderID: "1", OrderName: "book", OrderCost: 10}
+	if _, found := orderCache.Get(ctx, order.OrderID); found {
+		t.Fatal("Get() found order in empty cache")
+	}
+	orderCache.Fill(ctx, order, orderCache.Version(ctx, order.OrderID))
+	got, found := orderCache.Get(ctx, order.OrderID)
+	if !found || *got != *order {
+		t.Fatalf("Get() = %+v, %v, want %+v", got, found, order)
+	}
+	if !server.Exists("order:1") {
+		t.Error("order isn't stored under key prefix")
+	}
+	if ttl := server.TTL("order:1"); ttl != 0 {
+		t.Errorf("order ttl = %s, want no expiration", ttl)
+	}
+}
+
+func TestRedisCacheGetInvalidData(t *testing.T) {
+	orderCache, server, _ := newTestRedisCache(t, 0)
+	if err := server.Set("order:1", "not json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := orderCache.Get(context.Background(), "1"); found {
+		t.Error("Get() found order which can't be decoded")
+	}
+}
+
+func TestRedisCacheApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []model.OrderMessage
+		want     map[string]*model.Order
+	}{
+		{
+			name: "save and update",
+			messages: []model.OrderMessage{
+				{Method: methodSave, Data: &model.Order{OrderID: "1", OrderName: "book"}},
+				{Method: methodSave, Data: &model.Order{OrderID: "2", OrderName: "pen"}},
+				{Method: methodUpdate, Data: &model.Order{OrderID: "1", OrderName: "new book"}},
+			},
+			want: map[string]*model.Order{
+				"1": {OrderID: "1", OrderName: "new book"},
+				"2": {OrderID: "2", OrderName: "pen"},
+			},
+		},
+		{
+			name: "delete",
+			messages: []model.OrderMessage{
+				{Method: methodSave, Data: &model.Order{OrderID: "1", OrderName: "book"}},
+				{Method: methodDelete, Data: &model.Order{OrderID: "1"}},
+			},
+			want: map[string]*model.Order{"1": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderCache, _, _ := newTestRedisCache(t, 0)
+			ctx := context.Background()
+			if err := orderCache.apply(ctx, tt.messages); err != nil {
+				t.Fatalf("apply() error = %v", err)
+			}
+			for orderID, want := range tt.want {
+				got, found := orderCache.Get(ctx, orderID)
+				if want == nil {
+					if found {
+						t.Errorf("Get(%s) = %+v, want missing order", orderID, got)
+					}
+					continue
+				}
+				if !found || *got != *want {
+					t.Errorf("Get(%s) = %+v, %v, want %+v", orderID, got, found, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRedisCacheFillSkipsChangedOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		change model.OrderMessage
+		want   *model.Order
+	}{
+		{
+			name:   "updated during load",
+			change: model.OrderMessage{Method: methodUpdate, Data: &model.Order{OrderID: "1", OrderName: "new book"}},
+			want:   &model.Order{OrderID: "1", OrderName: "new book"},
+		},
+		{
+			name:   "deleted during load",
+			change: model.OrderMessage{Method: methodDelete, Data: &model.Order{OrderID: "1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderCache, _, _ := newTestRedisCache(t, 0)
+			ctx := context.Background()
+			version := orderCache.Version(ctx, "1")
+			if err := orderCache.apply(ctx, []model.OrderMessage{tt.change}); err != nil {
+				t.Fatalf("apply() error = %v", err)
+			}
+			orderCache.Fill(ctx, &model.Order{OrderID: "1", OrderName: "old book"}, version)
+			got, found := orderCache.Get(ctx, "1")
+			if tt.want == nil {
+				if found {
+					t.Errorf("Get() = %+v, want missing order", got)
+				}
+				return
+			}
+			if !found || *got != *tt.want {
+				t.Errorf("Get() = %+v, %v, want %+v", got, found, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedisCacheTTL(t *testing.T) {
+	orderCache, server, _ := newTestRedisCache(t, time.Minute)
+	ctx := context.Background()
+	orderCache.Fill(ctx, &model.Order{OrderID: "1"}, orderCache.Version(ctx, "1"))
+	if err := orderCache.apply(ctx, []model.OrderMessage{{Method: methodSave, Data: &model.Order{OrderID: "2"}}}); err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+	for _, key := range []string{"order:1", "order:2"} {
+		if ttl := server.TTL(key); ttl != time.Minute {
+			t.Errorf("%s ttl = %s, want %s", key, ttl, time.Minute)
+		}
+	}
+	server.FastForward(time.Minute)
+	for _, orderID := range []string{"1", "2"} {
+		if _, found := orderCache.Get(ctx, orderID); found {
+			t.Errorf("Get(%s) found expired order", orderID)
+		}
+	}
+	if server.Exists("order:version:2") {
+		t.Error("version of order is kept after versionTTL")
+	}
+}
+
+func TestRedisCachePublishesChanges(t *testing.T) {
+	orderCache, _, publisher := newTestRedisCache(t, 0)
+	ctx := context.Background()
+	order := &model.Order{OrderID: "1"}
+	_ = orderCache.Save(ctx, order)
+	_ = orderCache.Update(ctx, order)
+	_ = orderCache.Delete(ctx, order.OrderID)
+	want := []string{methodSave, methodUpdate, methodDelete}
+	if len(publisher.messages) != len(want) {
+		t.Fatalf("published %d messages, want %d", len(publisher.messages), len(want))
+	}
+	for i, method := range want {
+		if publisher.messages[i].Method != method || publisher.messages[i].Data.OrderID != order.OrderID {
+			t.Errorf("message %d = %+v, want %s of order %s", i, publisher.messages[i], method, order.OrderID)
+		}
+	}
+}
+
+func TestRedisCacheDrainWithoutConsumers(t *testing.T) {
+	orderCache, _, _ := newTestRedisCache(t, 0)
+	if err := orderCache.Drain(context.Background()); err != nil {
+		t.Errorf("Drain() error = %v", err)
+	}
+}
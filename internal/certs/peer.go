@@ -0,0 +1,32 @@
+package certs
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/auth"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// PeerPrincipal return principal built from verified client certificate of the rpc peer
+func PeerPrincipal(ctx context.Context) (*auth.Principal, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	cert := tlsInfo.State.VerifiedChains[0][0]
+	subject := cert.Subject.CommonName
+	switch {
+	case subject != "":
+	case len(cert.URIs) != 0:
+		subject = cert.URIs[0].String()
+	case len(cert.DNSNames) != 0:
+		subject = cert.DNSNames[0]
+	default:
+		return nil, false
+	}
+	return &auth.Principal{Subject: subject, AuthMethod: auth.AuthMethodMTLS}, true
+}
@@ -0,0 +1,131 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader keeps server certificate and client CA pool loaded from disk
+// and reloads them when files are changed
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	mutex        sync.RWMutex
+	cert         *tls.Certificate
+	clientCAs    *x509.CertPool
+	modTimes     map[string]time.Time
+}
+
+// NewReloader return new Reloader instance, clientCAFile is optional and
+// enables mutual tls when it is set
+func NewReloader(certFile, keyFile, clientCAFile string) (*Reloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("certs: certificate and key files are required")
+	}
+	reloader := &Reloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		modTimes:     make(map[string]time.Time),
+	}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// TLSConfig return server tls config which checks certificate files on every handshake
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			if r.changed() {
+				if err := r.load(); err != nil {
+					log.Errorf("certs: reload failed, previous certificates are kept - %v", err)
+				} else {
+					log.Info("certs: certificates reloaded")
+				}
+			}
+			return r.config(), nil
+		},
+	}
+}
+
+// config builds tls config from currently loaded certificates
+func (r *Reloader) config() *tls.Config {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*r.cert},
+	}
+	if r.clientCAs != nil {
+		cfg.ClientCAs = r.clientCAs
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg
+}
+
+// load read certificate, key and client CA files from disk
+func (r *Reloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("certs: can't stat %s - %w", file, err)
+		}
+		modTimes[file] = info.ModTime()
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("certs: can't load key pair - %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("certs: can't read client CA - %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("certs: no certificates found in %s", r.clientCAFile)
+		}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return nil
+}
+
+// changed checks whether any of certificate files was modified after last load
+func (r *Reloader) changed() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			// file can be missing for a moment while it is being replaced
+			continue
+		}
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+	return files
+}
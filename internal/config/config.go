@@ -1,8 +1,9 @@
 package config
 
+import "time"
+
 // Config type store all env info
 type Config struct {
-	SecretKey       string `env:"SECRETKEY"`
 	PostgresdbURL   string `env:"POSTGRESDB_URL"`
 	PortgRPC        string `env:"PORTGRPC"`
 	RabbitUser      string `env:"RABBITUSER"`
@@ -14,4 +15,79 @@ type Config struct {
 	KafkaHost       string `env:"KAFKAHOST"`
 	KafkaTopic      string `env:"KAFKATOPIC"`
 	KafkaGroupID    string `env:"KafkaGID"`
+
+	// RabbitRevocationExchange is fanout exchange which shares token revocations between replicas
+	RabbitRevocationExchange string `env:"RABBITREVOCATIONEXCHANGE" envDefault:"token-revocations"`
+
+	TLSCertFile     string `env:"TLSCERT"`
+	TLSKeyFile      string `env:"TLSKEY"`
+	TLSClientCAFile string `env:"TLSCLIENTCA"`
+
+	HTTPPort string `env:"HTTPPORT" envDefault:":9090"`
+
+	JWTAlgorithm      string        `env:"JWTALGORITHM" envDefault:"RS256"`
+	JWTKeysDir        string        `env:"JWTKEYSDIR" envDefault:"keys"`
+	JWTKeyRotation    time.Duration `env:"JWTKEYROTATION" envDefault:"168h"`
+	JWTKeyCheckPeriod time.Duration `env:"JWTKEYCHECKPERIOD" envDefault:"1m"`
+	JWTIssuer         string        `env:"JWTISSUER" envDefault:"ordercrud"`
+	JWTAudience       string        `env:"JWTAUDIENCE" envDefault:"ordercrud"`
+	AccessTokenTTL    time.Duration `env:"ACCESSTOKENTTL" envDefault:"15m"`
+	RefreshTokenTTL   time.Duration `env:"REFRESHTOKENTTL" envDefault:"720h"`
+
+	Mailer                   string        `env:"MAILER"`
+	MailLogDev               bool          `env:"MAILLOGDEV" envDefault:"false"`
+	MailFrom                 string        `env:"MAILFROM" envDefault:"no-reply@localhost"`
+	MailDir                  string        `env:"MAILDIR" envDefault:"mail"`
+	SMTPAddr                 string        `env:"SMTPADDR"`
+	SMTPUser                 string        `env:"SMTPUSER"`
+	SMTPPassword             string        `env:"SMTPPASSWORD"`
+	RequireEmailVerification bool          `env:"REQUIREEMAILVERIFICATION" envDefault:"false"`
+	EmailVerificationTTL     time.Duration `env:"EMAILVERIFICATIONTTL" envDefault:"24h"`
+	PasswordResetTTL         time.Duration `env:"PASSWORDRESETTTL" envDefault:"1h"`
+
+	LoginMaxFailures   int           `env:"LOGINMAXFAILURES" envDefault:"5"`
+	LoginIPMaxFailures int           `env:"LOGINIPMAXFAILURES" envDefault:"20"`
+	LoginBackoffBase   time.Duration `env:"LOGINBACKOFFBASE" envDefault:"1s"`
+	LoginBackoffMax    time.Duration `env:"LOGINBACKOFFMAX" envDefault:"30s"`
+	LoginLockout       time.Duration `env:"LOGINLOCKOUT" envDefault:"15m"`
+	AuditLogFile       string        `env:"AUDITLOGFILE"`
+
+	TOTPIssuer      string        `env:"TOTPISSUER" envDefault:"ordercrud"`
+	MFAChallengeTTL time.Duration `env:"MFACHALLENGETTL" envDefault:"5m"`
+
+	// OIDCIssuer enables login with external OpenID Connect provider, e.g. corporate IdP or
+	// local mock server, OIDCRedirectURL must match redirect uri used by clients
+	OIDCIssuer       string   `env:"OIDCISSUER"`
+	OIDCClientID     string   `env:"OIDCCLIENTID"`
+	OIDCClientSecret string   `env:"OIDCCLIENTSECRET"`
+	OIDCRedirectURL  string   `env:"OIDCREDIRECTURL"`
+	OIDCScopes       []string `env:"OIDCSCOPES" envSeparator:"," envDefault:"openid,email,profile"`
+
+	// OIDCLinkTTL limits time to confirm linking identity to existing account with the same email,
+	// OIDCReauthTTL limits time to confirm sensitive changes after signing in with provider again
+	OIDCLinkTTL   time.Duration `env:"OIDCLINKTTL" envDefault:"1h"`
+	OIDCReauthTTL time.Duration `env:"OIDCREAUTHTTL" envDefault:"5m"`
+
+	// CacheBackend is memory or redis, CacheMaxEntries and CacheMaxBytes limit in-memory
+	// order cache, zero means no limit. CacheTTL applies to both backends
+	CacheBackend    string        `env:"CACHEBACKEND" envDefault:"memory"`
+	CacheMaxEntries int           `env:"CACHEMAXENTRIES" envDefault:"10000"`
+	CacheMaxBytes   int64         `env:"CACHEMAXBYTES" envDefault:"0"`
+	CacheTTL        time.Duration `env:"CACHETTL" envDefault:"10m"`
+	RedisAddr       string        `env:"REDISADDR" envDefault:"localhost:6379"`
+	RedisPassword   string        `env:"REDISPASSWORD"`
+	RedisDB         int           `env:"REDISDB" envDefault:"0"`
+	RedisKeyPrefix  string        `env:"REDISKEYPREFIX" envDefault:"order:"`
+
+	LogRedactFields []string `env:"LOGREDACTFIELDS" envSeparator:","`
+
+	RateLimitDefault string   `env:"RATELIMITDEFAULT" envDefault:"20:40"`
+	RateLimitPeer    string   `env:"RATELIMITPEER" envDefault:"50:100"`
+	RateLimits       []string `env:"RATELIMITS" envSeparator:"," envDefault:"/protocol.CRUD/Authentication=0.2:5,/protocol.CRUD/Registration=0.1:3,/protocol.CRUD/RefreshToken=0.5:5,/protocol.CRUD/VerifyEmail=0.2:5,/protocol.CRUD/RequestPasswordReset=0.05:3,/protocol.CRUD/ResetPassword=0.2:5,/protocol.CRUD/VerifyMFA=0.2:5,/protocol.CRUD/ChangePassword=0.2:5,/protocol.CRUD/DeleteAccount=0.1:3,/protocol.CRUD/OIDCLogin=0.2:5,/protocol.CRUD/ConfirmIdentityLink=0.2:5,/protocol.CRUD/OIDCReauthenticate=0.2:5"`
+
+	TracingExporter string `env:"TRACINGEXPORTER"`
+	OTLPEndpoint    string `env:"OTLPENDPOINT" envDefault:"localhost:4317"`
+	OTLPInsecure    bool   `env:"OTLPINSECURE" envDefault:"true"`
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWNTIMEOUT" envDefault:"15s"`
 }
@@ -0,0 +1,33 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// Server represent http server which exposes service endpoints beside gRPC, such as metrics and JWKS
+type Server struct {
+	httpServer *http.Server
+}
+
+// NewServer return new Server instance, which listens on addr after Start call
+func NewServer(addr string, handler http.Handler) *Server {
+	return &Server{httpServer: &http.Server{Addr: addr, Handler: handler}}
+}
+
+// Start run http server in background
+func (s *Server) Start() {
+	go func() {
+		log.Printf("http server listening at %s", s.httpServer.Addr)
+		if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("http server failed - %v", err)
+		}
+	}()
+}
+
+// Shutdown stop http server
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
@@ -0,0 +1,99 @@
+package idp
+
+import (
+	"context"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"net/http"
+	"time"
+)
+
+// exchangeTimeout limits requests to token endpoint and jwks of identity provider
+const exchangeTimeout = 10 * time.Second
+
+// Identity struct represents user authenticated by identity provider, Issuer and Subject
+// identify the user permanently while email can change. AuthTime is zero when provider
+// didn't tell when the user entered credentials
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	AuthTime      time.Time
+}
+
+// Provider exchanges authorization codes issued by external OpenID Connect provider for
+// verified identities, signing keys of ID tokens are taken from provider jwks
+type Provider struct {
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	client   *http.Client
+}
+
+// New return new Provider instance, provider configuration is discovered from
+// issuer/.well-known/openid-configuration, so issuer must be reachable on startup
+func New(ctx context.Context, issuer, clientID, clientSecret, redirectURL string, scopes []string) (*Provider, error) {
+	client := &http.Client{Timeout: exchangeTimeout}
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, client), issuer)
+	if err != nil {
+		return nil, fmt.Errorf("idp: can't discover provider %s - %w", issuer, err)
+	}
+	return &Provider{
+		oauth: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+		client:   client,
+	}, nil
+}
+
+// Exchange redeem authorization code with PKCE code verifier and verify returned ID token, nonce
+// must be the one which client put in authorization request
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	ctx = oidc.ClientContext(ctx, p.client)
+	token, err := p.oauth.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("idp: code exchange failed - %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("idp: no id_token in token response")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("idp: invalid id token - %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("idp: id token nonce doesn't match")
+	}
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+		AuthTime          int64  `json:"auth_time"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("idp: can't parse id token claims - %w", err)
+	}
+	identity := &Identity{
+		Issuer:        idToken.Issuer,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}
+	if identity.Name == "" {
+		identity.Name = claims.PreferredUsername
+	}
+	if claims.AuthTime != 0 {
+		identity.AuthTime = time.Unix(claims.AuthTime, 0)
+	}
+	return identity, nil
+}
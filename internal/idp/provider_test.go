@@ -0,0 +1,118 @@
+package idp
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/idp/idptest"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID = "ordercrud"
+	testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testNonce    = "n-0S6_WzA2Mj"
+)
+
+func TestExchange(t *testing.T) {
+	server := idptest.NewServer(t)
+	provider, err := New(context.Background(), server.URL, testClientID, "secret", "http://localhost/callback", []string{"openid", "email"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	authTime := time.Now().Add(-time.Minute).Unix()
+	tests := []struct {
+		name         string
+		claims       map[string]interface{}
+		codeVerifier string
+		nonce        string
+		want         *Identity
+		wantErr      bool
+	}{
+		{
+			name: "pkce exchange",
+			claims: map[string]interface{}{"sub": "user-1", "nonce": testNonce, "email": "user@example.com",
+				"email_verified": true, "name": "User", "auth_time": authTime},
+			codeVerifier: testVerifier,
+			nonce:        testNonce,
+			want: &Identity{Issuer: server.URL, Subject: "user-1", Email: "user@example.com", EmailVerified: true,
+				Name: "User", AuthTime: time.Unix(authTime, 0)},
+		},
+		{
+			name:         "preferred username",
+			claims:       map[string]interface{}{"sub": "user-2", "nonce": testNonce, "preferred_username": "user2"},
+			codeVerifier: testVerifier,
+			nonce:        testNonce,
+			want:         &Identity{Issuer: server.URL, Subject: "user-2", Name: "user2"},
+		},
+		{
+			name:         "unverified email",
+			claims:       map[string]interface{}{"sub": "user-3", "nonce": testNonce, "email": "user@example.com"},
+			codeVerifier: testVerifier,
+			nonce:        testNonce,
+			want:         &Identity{Issuer: server.URL, Subject: "user-3", Email: "user@example.com"},
+		},
+		{
+			name:         "wrong code verifier",
+			claims:       map[string]interface{}{"sub": "user-1", "nonce": testNonce},
+			codeVerifier: "wrong-verifier-wrong-verifier-wrong-verifier",
+			nonce:        testNonce,
+			wantErr:      true,
+		},
+		{
+			name:         "bad nonce",
+			claims:       map[string]interface{}{"sub": "user-1", "nonce": "other"},
+			codeVerifier: testVerifier,
+			nonce:        testNonce,
+			wantErr:      true,
+		},
+		{
+			name:         "missing nonce",
+			claims:       map[string]interface{}{"sub": "user-1"},
+			codeVerifier: testVerifier,
+			nonce:        testNonce,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := server.Authorize(testClientID, idptest.CodeChallenge(testVerifier), tt.claims)
+			got, err := provider.Exchange(context.Background(), code, tt.codeVerifier, tt.nonce)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Exchange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *got != *tt.want {
+				t.Errorf("Exchange() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeIsUsedOnce(t *testing.T) {
+	server := idptest.NewServer(t)
+	provider, err := New(context.Background(), server.URL, testClientID, "secret", "http://localhost/callback", nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	code := server.Authorize(testClientID, idptest.CodeChallenge(testVerifier), map[string]interface{}{"sub": "user-1", "nonce": testNonce})
+	if _, err := provider.Exchange(context.Background(), code, testVerifier, testNonce); err != nil {
+		t.Fatalf("first Exchange() error = %v", err)
+	}
+	if _, err := provider.Exchange(context.Background(), code, testVerifier, testNonce); err == nil {
+		t.Errorf("second Exchange() error = nil, want error")
+	}
+}
+
+func TestExchangeRejectsTokenForOtherClient(t *testing.T) {
+	server := idptest.NewServer(t)
+	provider, err := New(context.Background(), server.URL, testClientID, "secret", "http://localhost/callback", nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	code := server.Authorize("other-client", idptest.CodeChallenge(testVerifier), map[string]interface{}{"sub": "user-1", "nonce": testNonce})
+	if _, err := provider.Exchange(context.Background(), code, testVerifier, testNonce); err == nil {
+		t.Errorf("Exchange() error = nil, want error")
+	}
+}
@@ -0,0 +1,132 @@
+package interceptor
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/auth"
+	"github.com/EgorBessonov/gRPC/internal/certs"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// publicMethods can be called without access token, all other rpc require authentication
+var publicMethods = map[string]bool{
+	"/protocol.CRUD/Registration":         true,
+	"/protocol.CRUD/Authentication":       true,
+	"/protocol.CRUD/RefreshToken":         true,
+	"/protocol.CRUD/VerifyEmail":          true,
+	"/protocol.CRUD/VerifyMFA":            true,
+	"/protocol.CRUD/RequestPasswordReset": true,
+	"/protocol.CRUD/ResetPassword":        true,
+	"/protocol.CRUD/OIDCLogin":            true,
+	"/protocol.CRUD/ConfirmIdentityLink":  true,
+}
+
+// adminMethods can be called only by principals with admin role
+var adminMethods = map[string]bool{
+	"/protocol.CRUD/RevokeTokens":  true,
+	"/protocol.CRUD/UnlockAccount": true,
+}
+
+// methodScopes maps rpc to scope required to call it, api keys can call only these methods
+var methodScopes = map[string]string{
+	"/protocol.CRUD/GetOrder":    auth.ScopeOrdersRead,
+	"/protocol.CRUD/SaveOrder":   auth.ScopeOrdersWrite,
+	"/protocol.CRUD/UpdateOrder": auth.ScopeOrdersWrite,
+	"/protocol.CRUD/DeleteOrder": auth.ScopeOrdersWrite,
+	"/protocol.CRUD/UploadImage": auth.ScopeOrdersWrite,
+}
+
+// APIKeyKey is metadata key which carries api key of service client
+const APIKeyKey = "x-api-key"
+
+// TokenValidator checks access token or api key of the request and returns its principal
+type TokenValidator interface {
+	ValidateToken(ctx context.Context) (*auth.Principal, error)
+	ValidateAPIKey(ctx context.Context, key string) (*auth.Principal, error)
+}
+
+// RevocationChecker checks whether access token of principal was revoked before it expired
+type RevocationChecker interface {
+	IsRevoked(principal *auth.Principal) bool
+}
+
+// UnaryAuth validate jwt access token of unary rpc
+func UnaryAuth(validator TokenValidator, revocations RevocationChecker) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, validator, revocations, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, request)
+	}
+}
+
+// StreamAuth validate jwt access token of stream rpc
+func StreamAuth(validator TokenValidator, revocations RevocationChecker) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), validator, revocations, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, withContext(stream, ctx))
+	}
+}
+
+// authenticate checks caller access token or api key, client certificate identity
+// is put into context when peer is authenticated with mutual tls
+func authenticate(ctx context.Context, validator TokenValidator, revocations RevocationChecker, method string) (context.Context, error) {
+	if principal, ok := certs.PeerPrincipal(ctx); ok {
+		ctx = auth.NewContext(ctx, principal)
+	}
+	if publicMethods[method] {
+		return ctx, nil
+	}
+	if key := apiKeyFromContext(ctx); key != "" {
+		principal, err := validator.ValidateAPIKey(ctx, key)
+		if err != nil {
+			logging.FromContext(ctx).Errorf("interceptor: authentication failed - %v", err)
+			return nil, status.Error(codes.Unauthenticated, "invalid api key")
+		}
+		return authorize(ctx, principal, method)
+	}
+	principal, err := validator.ValidateToken(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("interceptor: authentication failed - %v", err)
+		return nil, status.Error(codes.Unauthenticated, "invalid or missing access token")
+	}
+	if revocations.IsRevoked(principal) {
+		logging.FromContext(ctx).WithField("tokenID", principal.TokenID).Warn("interceptor: revoked access token presented")
+		return nil, status.Error(codes.Unauthenticated, "access token was revoked")
+	}
+	return authorize(ctx, principal, method)
+}
+
+// authorize checks that principal has role and scope required by method
+func authorize(ctx context.Context, principal *auth.Principal, method string) (context.Context, error) {
+	if adminMethods[method] && !principal.HasRole(auth.RoleAdmin) {
+		return nil, status.Error(codes.PermissionDenied, "admin role is required")
+	}
+	scope, ok := methodScopes[method]
+	if !ok && principal.AuthMethod == auth.AuthMethodAPIKey {
+		return nil, status.Error(codes.PermissionDenied, "method is not available to api keys")
+	}
+	if ok && !principal.HasScope(scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "scope %s is required", scope)
+	}
+	return auth.NewContext(ctx, principal), nil
+}
+
+// apiKeyFromContext return api key from request metadata
+func apiKeyFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if key := md.Get(APIKeyKey); len(key) != 0 {
+		return key[0]
+	}
+	return ""
+}
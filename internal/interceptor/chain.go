@@ -0,0 +1,33 @@
+package interceptor
+
+import (
+	"github.com/EgorBessonov/gRPC/internal/ratelimit"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+)
+
+// ServerOptions return interceptor chains which apply the same policy to unary and stream rpc.
+// Logging and metrics go before recovery to record Internal code of recovered panics. Peer limit goes
+// before auth to throttle credential guessing, method limits go after auth to identify callers by principal
+func ServerOptions(validator TokenValidator, revocations RevocationChecker, peerLimiter, limiter *ratelimit.Limiter) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			otelgrpc.UnaryServerInterceptor(),
+			UnaryLogging,
+			UnaryMetrics,
+			UnaryRecovery,
+			UnaryPeerRateLimit(peerLimiter),
+			UnaryAuth(validator, revocations),
+			UnaryRateLimit(limiter),
+		),
+		grpc.ChainStreamInterceptor(
+			otelgrpc.StreamServerInterceptor(),
+			StreamLogging,
+			StreamMetrics,
+			StreamRecovery,
+			StreamPeerRateLimit(peerLimiter),
+			StreamAuth(validator, revocations),
+			StreamRateLimit(limiter),
+		),
+	}
+}
@@ -0,0 +1,81 @@
+package interceptor
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+const (
+	// RequestIDKey is metadata key which carries request correlation id
+	RequestIDKey = "x-request-id"
+
+	maxRequestIDLength = 128
+)
+
+// UnaryLogging assign or propagate request id, put request scoped logger into context
+// and write access log line for every unary rpc
+func UnaryLogging(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx, logger := newRequestLogger(ctx, info.FullMethod)
+	response, err := handler(ctx, request)
+	accessLog(logger, start, err)
+	return response, err
+}
+
+// StreamLogging is the same as UnaryLogging for stream rpc
+func StreamLogging(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, logger := newRequestLogger(stream.Context(), info.FullMethod)
+	err := handler(srv, withContext(stream, ctx))
+	accessLog(logger, start, err)
+	return err
+}
+
+// newRequestLogger return context with request scoped logger, request id is also sent back in response header
+func newRequestLogger(ctx context.Context, method string) (context.Context, *log.Entry) {
+	requestID := requestIDFromContext(ctx)
+	if err := grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, requestID)); err != nil {
+		log.Warnf("interceptor: can't set request id header - %v", err)
+	}
+	fields := log.Fields{
+		"requestID": requestID,
+		"method":    method,
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		fields["traceID"] = spanContext.TraceID().String()
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields["peer"] = p.Addr.String()
+	}
+	logger := log.WithFields(fields)
+	return logging.NewContext(ctx, logger), logger
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDKey); len(values) != 0 && values[0] != "" && len(values[0]) <= maxRequestIDLength {
+			return values[0]
+		}
+	}
+	return uuid.New().String()
+}
+
+func accessLog(logger *log.Entry, start time.Time, err error) {
+	entry := logger.WithFields(log.Fields{
+		"code":     status.Code(err).String(),
+		"duration": time.Since(start).String(),
+	})
+	if err != nil {
+		entry.WithError(err).Warn("rpc finished")
+		return
+	}
+	entry.Info("rpc finished")
+}
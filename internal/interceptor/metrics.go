@@ -0,0 +1,30 @@
+package interceptor
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// UnaryMetrics count unary rpc and observe their latency
+func UnaryMetrics(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	response, err := handler(ctx, request)
+	observeRPC(info.FullMethod, start, err)
+	return response, err
+}
+
+// StreamMetrics count stream rpc and observe their duration
+func StreamMetrics(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, stream)
+	observeRPC(info.FullMethod, start, err)
+	return err
+}
+
+func observeRPC(method string, start time.Time, err error) {
+	metrics.RPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	metrics.RPCRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+}
@@ -0,0 +1,102 @@
+package interceptor
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/auth"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"math"
+	"net"
+	"strconv"
+)
+
+// peerMethod is bucket name of peer limit which is shared by all methods
+const peerMethod = "*"
+
+// UnaryRateLimit reject rpc when caller exceeds method limit, callers are identified
+// by authenticated principal or by peer ip for unauthenticated rpc
+func UnaryRateLimit(limiter *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkRateLimit(ctx, limiter, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, request)
+	}
+}
+
+// StreamRateLimit is the same as UnaryRateLimit for stream rpc, limit is checked when stream is opened
+func StreamRateLimit(limiter *ratelimit.Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkRateLimit(stream.Context(), limiter, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+// UnaryPeerRateLimit reject rpc when peer ip exceeds limit shared by all methods, it goes before auth,
+// so calls with invalid credentials are throttled as well
+func UnaryPeerRateLimit(limiter *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkLimit(ctx, limiter, peerMethod, peerKey(ctx)); err != nil {
+			return nil, err
+		}
+		return handler(ctx, request)
+	}
+}
+
+// StreamPeerRateLimit is the same as UnaryPeerRateLimit for stream rpc, limit is checked when stream is opened
+func StreamPeerRateLimit(limiter *ratelimit.Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkLimit(stream.Context(), limiter, peerMethod, peerKey(stream.Context())); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+func checkRateLimit(ctx context.Context, limiter *ratelimit.Limiter, method string) error {
+	return checkLimit(ctx, limiter, method, callerKey(ctx))
+}
+
+func checkLimit(ctx context.Context, limiter *ratelimit.Limiter, method, caller string) error {
+	allowed, retryAfter, err := limiter.Allow(ctx, method, caller)
+	if err != nil {
+		// limiter store failure shouldn't make service unavailable
+		logging.FromContext(ctx).Errorf("interceptor: rate limit check failed - %v", err)
+		return nil
+	}
+	if allowed {
+		return nil
+	}
+	seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	if err := grpc.SetHeader(ctx, metadata.Pairs(ratelimit.RetryAfterKey, seconds)); err != nil {
+		logging.FromContext(ctx).Warnf("interceptor: can't set retry-after header - %v", err)
+	}
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %ss", seconds)
+}
+
+// callerKey return identity used as rate limit bucket key
+func callerKey(ctx context.Context) string {
+	if principal, ok := auth.FromContext(ctx); ok && principal.Subject != "" {
+		return "user:" + principal.Subject
+	}
+	return peerKey(ctx)
+}
+
+// peerKey return peer ip used as rate limit bucket key
+func peerKey(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return "ip:" + host
+	}
+	return "unknown"
+}
@@ -0,0 +1,37 @@
+package interceptor
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"runtime/debug"
+)
+
+// UnaryRecovery turn panic in unary rpc into Internal error
+func UnaryRecovery(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (response interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoverPanic(ctx, info.FullMethod, r)
+		}
+	}()
+	return handler(ctx, request)
+}
+
+// StreamRecovery turn panic in stream rpc into Internal error
+func StreamRecovery(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoverPanic(stream.Context(), info.FullMethod, r)
+		}
+	}()
+	return handler(srv, stream)
+}
+
+func recoverPanic(ctx context.Context, method string, r interface{}) error {
+	metrics.RPCPanics.WithLabelValues(method).Inc()
+	logging.FromContext(ctx).WithField("stack", string(debug.Stack())).Errorf("interceptor: panic recovered - %v", r)
+	return status.Error(codes.Internal, "internal server error")
+}
@@ -0,0 +1,22 @@
+package interceptor
+
+import (
+	"context"
+	"google.golang.org/grpc"
+)
+
+// serverStream overrides context of wrapped grpc.ServerStream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context implements grpc.ServerStream
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// withContext return stream which carries ctx
+func withContext(stream grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	return &serverStream{ServerStream: stream, ctx: ctx}
+}
@@ -0,0 +1,278 @@
+package keyset
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AlgorithmRS256 signs tokens with RSA PKCS#1 v1.5 and SHA-256
+	AlgorithmRS256 = "RS256"
+	// AlgorithmEdDSA signs tokens with Ed25519
+	AlgorithmEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+	keyFileExt = ".pem"
+)
+
+type key struct {
+	id        string
+	method    jwt.SigningMethod
+	private   crypto.PrivateKey
+	public    crypto.PublicKey
+	createdAt time.Time
+}
+
+// KeySet keeps jwt signing keys stored as pem files in directory. New key is published in JWKS first
+// and the newest key which is older than activation delay signs tokens, so verifiers learn about the key
+// before they see tokens signed by it. Older keys are kept for verification until tokens signed by them expire
+type KeySet struct {
+	dir        string
+	algorithm  string
+	rotation   time.Duration
+	retention  time.Duration
+	activation time.Duration
+	mutex      sync.RWMutex
+	keys       map[string]*key
+	active     *key
+}
+
+// New return new KeySet instance, a key is rotated every rotation period and kept for verification during
+// retention after it stops signing, which should be not less than token lifetime. Key starts signing after
+// activation delay, which should cover JWKS cache lifetime and key reload period of other replicas
+func New(dir, algorithm string, rotation, retention, activation time.Duration) (*KeySet, error) {
+	if algorithm != AlgorithmRS256 && algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("keyset: unsupported algorithm %q", algorithm)
+	}
+	if rotation <= activation {
+		return nil, fmt.Errorf("keyset: rotation period %s must be longer than activation delay %s", rotation, activation)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("keyset: can't create keys directory - %w", err)
+	}
+	ks := &KeySet{
+		dir:        dir,
+		algorithm:  algorithm,
+		rotation:   rotation,
+		retention:  retention,
+		activation: activation,
+	}
+	if err := ks.refresh(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Run reload keys from directory and rotate them every interval until ctx is cancelled,
+// reload picks up keys created by other service replicas sharing the directory
+func (ks *KeySet) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.refresh(); err != nil {
+				log.Errorf("keyset: refresh failed - %v", err)
+			}
+		}
+	}
+}
+
+// Sign return token with claims signed by active key, key id is put in kid header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	ks.mutex.RLock()
+	active := ks.active
+	ks.mutex.RUnlock()
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = active.id
+	signed, err := token.SignedString(active.private)
+	if err != nil {
+		return "", fmt.Errorf("keyset: can't sign token - %w", err)
+	}
+	return signed, nil
+}
+
+// Parse verify token signature with the key from kid header and parse claims
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		ks.mutex.RLock()
+		k, ok := ks.keys[kid]
+		ks.mutex.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("keyset: unknown key %q", kid)
+		}
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("keyset: unexpected signing method %v", token.Header["alg"])
+		}
+		return k.public, nil
+	})
+}
+
+// refresh load keys from directory, generate next key when the newest one is older than rotation
+// period, pick signing key and drop keys which passed retention
+func (ks *KeySet) refresh() error {
+	keys, err := ks.load()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if last := newest(keys); last == nil || now.Sub(last.createdAt) >= ks.rotation {
+		next, err := ks.generate(now)
+		if err != nil {
+			return err
+		}
+		keys[next.id] = next
+		log.WithField("kid", next.id).Info("keyset: new key generated, it signs tokens after activation delay")
+	}
+	active := activeKey(keys, now, ks.activation)
+	// key stops signing when the next one is activated, that is not later than rotation+activation after creation
+	for id, k := range keys {
+		if k != active && now.Sub(k.createdAt) >= ks.rotation+ks.activation+ks.retention {
+			delete(keys, id)
+			if err := os.Remove(ks.path(id)); err != nil && !os.IsNotExist(err) {
+				log.Errorf("keyset: can't remove retired key %s - %v", id, err)
+			}
+			log.WithField("kid", id).Info("keyset: signing key retired")
+		}
+	}
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	if ks.active == nil || ks.active.id != active.id {
+		log.WithField("kid", active.id).Info("keyset: signing key activated")
+	}
+	ks.keys = keys
+	ks.active = active
+	return nil
+}
+
+// load read all pem keys from directory, key id is file name without extension
+func (ks *KeySet) load() (map[string]*key, error) {
+	files, err := filepath.Glob(filepath.Join(ks.dir, "*"+keyFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("keyset: can't list keys - %w", err)
+	}
+	keys := make(map[string]*key, len(files))
+	for _, file := range files {
+		k, err := readKey(file)
+		if err != nil {
+			return nil, err
+		}
+		keys[k.id] = k
+	}
+	return keys, nil
+}
+
+// generate create new key of configured algorithm and write it into directory
+func (ks *KeySet) generate(now time.Time) (*key, error) {
+	var private crypto.PrivateKey
+	var err error
+	switch ks.algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("keyset: can't generate key - %w", err)
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("keyset: can't generate key id - %w", err)
+	}
+	id := fmt.Sprintf("%d-%s", now.Unix(), hex.EncodeToString(suffix))
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("keyset: can't encode key - %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(ks.path(id), data, 0600); err != nil {
+		return nil, fmt.Errorf("keyset: can't write key - %w", err)
+	}
+	return newKey(id, private, now)
+}
+
+func (ks *KeySet) path(id string) string {
+	return filepath.Join(ks.dir, id+keyFileExt)
+}
+
+// readKey parse pem private key file, creation time is taken from key id made by generate
+// or from file modification time for keys added manually
+func readKey(file string) (*key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("keyset: can't read %s - %w", file, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("keyset: no pem data in %s", file)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("keyset: can't parse %s - %w", file, err)
+		}
+	}
+	id := strings.TrimSuffix(filepath.Base(file), keyFileExt)
+	createdAt := time.Time{}
+	if unix, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64); err == nil {
+		createdAt = time.Unix(unix, 0)
+	} else if info, err := os.Stat(file); err == nil {
+		createdAt = info.ModTime()
+	}
+	return newKey(id, private, createdAt)
+}
+
+func newKey(id string, private crypto.PrivateKey, createdAt time.Time) (*key, error) {
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		return &key{id: id, method: jwt.SigningMethodRS256, private: private, public: &private.PublicKey, createdAt: createdAt}, nil
+	case ed25519.PrivateKey:
+		return &key{id: id, method: jwt.SigningMethodEdDSA, private: private, public: private.Public(), createdAt: createdAt}, nil
+	default:
+		return nil, fmt.Errorf("keyset: unsupported key type %T of key %s", private, id)
+	}
+}
+
+// activeKey return the newest key created at least activation ago, the newest key is used
+// when all keys are younger, e.g. when the first key is generated
+func activeKey(keys map[string]*key, now time.Time, activation time.Duration) *key {
+	published := make(map[string]*key, len(keys))
+	for id, k := range keys {
+		if now.Sub(k.createdAt) >= activation {
+			published[id] = k
+		}
+	}
+	if active := newest(published); active != nil {
+		return active
+	}
+	return newest(keys)
+}
+
+func newest(keys map[string]*key) *key {
+	var result *key
+	for _, k := range keys {
+		if result == nil || k.createdAt.After(result.createdAt) {
+			result = k
+		}
+	}
+	return result
+}
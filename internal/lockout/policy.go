@@ -0,0 +1,35 @@
+package lockout
+
+import "time"
+
+// Policy describes for how long logins are blocked after consecutive failures, every failure
+// doubles the delay starting from BaseDelay up to MaxDelay, Threshold failures lock logins out
+type Policy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Lockout   time.Duration
+}
+
+// Delay return time for which logins are blocked after failures consecutive failed attempts
+func (p Policy) Delay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	if p.Threshold > 0 && failures >= p.Threshold {
+		return p.Lockout
+	}
+	delay := p.BaseDelay
+	for i := 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+// LockedOut checks whether failures reached the threshold
+func (p Policy) LockedOut(failures int) bool {
+	return p.Threshold > 0 && failures >= p.Threshold
+}
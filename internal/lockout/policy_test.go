@@ -0,0 +1,36 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{Threshold: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second, Lockout: time.Hour}
+	tests := []struct {
+		name     string
+		policy   Policy
+		failures int
+		want     time.Duration
+	}{
+		{name: "no failures", policy: policy, failures: 0, want: 0},
+		{name: "first failure", policy: policy, failures: 1, want: time.Second},
+		{name: "delay doubles", policy: policy, failures: 3, want: 4 * time.Second},
+		{name: "delay is capped", policy: policy, failures: 5, want: 10 * time.Second},
+		{name: "below threshold", policy: policy, failures: 9, want: 10 * time.Second},
+		{name: "threshold locks out", policy: policy, failures: 10, want: time.Hour},
+		{name: "above threshold", policy: policy, failures: 20, want: time.Hour},
+		{name: "no threshold", policy: Policy{BaseDelay: time.Second, MaxDelay: time.Minute, Lockout: time.Hour}, failures: 100, want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Delay(tt.failures); got != tt.want {
+				t.Errorf("Delay(%d) = %s, want %s", tt.failures, got, tt.want)
+			}
+			wantLockedOut := tt.policy.Threshold > 0 && tt.failures >= tt.policy.Threshold
+			if got := tt.policy.LockedOut(tt.failures); got != wantLockedOut {
+				t.Errorf("LockedOut(%d) = %v, want %v", tt.failures, got, wantLockedOut)
+			}
+		})
+	}
+}
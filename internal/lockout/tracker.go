@@ -0,0 +1,78 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+type entry struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// Tracker counts failed logins by key, such as source address, in process memory. Failures
+// are forgotten when there were no new ones during lockout period
+type Tracker struct {
+	policy    Policy
+	mutex     sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewTracker return new Tracker instance
+func NewTracker(policy Policy) *Tracker {
+	return &Tracker{
+		policy:    policy,
+		entries:   make(map[string]*entry),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Blocked return time left until logins with key are allowed again, zero means they are allowed
+func (t *Tracker) Blocked(key string) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	e, ok := t.entries[key]
+	if !ok {
+		return 0
+	}
+	if wait := e.blockedUntil.Sub(t.now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Fail records failed login with key, it returns time for which next logins are blocked
+// and whether failures reached lockout threshold
+func (t *Tracker) Fail(key string) (time.Duration, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := t.now()
+	t.sweep(now)
+	e, ok := t.entries[key]
+	if !ok || now.Sub(e.lastFailure) >= t.policy.Lockout {
+		e = &entry{}
+		t.entries[key] = e
+	}
+	e.failures++
+	e.lastFailure = now
+	delay := t.policy.Delay(e.failures)
+	e.blockedUntil = now.Add(delay)
+	return delay, t.policy.LockedOut(e.failures)
+}
+
+// sweep drop entries without failures during lockout period
+func (t *Tracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.policy.Lockout {
+		return
+	}
+	for key, e := range t.entries {
+		if now.Sub(e.lastFailure) >= t.policy.Lockout && !now.Before(e.blockedUntil) {
+			delete(t.entries, key)
+		}
+	}
+	t.lastSweep = now
+}
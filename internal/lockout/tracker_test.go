@@ -0,0 +1,95 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+type trackerStep struct {
+	advance time.Duration
+	key     string
+	// fail records failure, otherwise Blocked is checked
+	fail          bool
+	wantDelay     time.Duration
+	wantLockedOut bool
+}
+
+func TestTracker(t *testing.T) {
+	policy := Policy{Threshold: 3, BaseDelay: time.Second, MaxDelay: time.Minute, Lockout: 10 * time.Minute}
+	tests := []struct {
+		name  string
+		steps []trackerStep
+	}{
+		{
+			name: "backoff then lockout",
+			steps: []trackerStep{
+				{key: "a", wantDelay: 0},
+				{key: "a", fail: true, wantDelay: time.Second},
+				{key: "a", wantDelay: time.Second},
+				{advance: 500 * time.Millisecond, key: "a", wantDelay: 500 * time.Millisecond},
+				{advance: 500 * time.Millisecond, key: "a", wantDelay: 0},
+				{key: "a", fail: true, wantDelay: 2 * time.Second},
+				{key: "a", fail: true, wantDelay: 10 * time.Minute, wantLockedOut: true},
+				{advance: 5 * time.Minute, key: "a", wantDelay: 5 * time.Minute},
+				{advance: 5 * time.Minute, key: "a", wantDelay: 0},
+			},
+		},
+		{
+			name: "keys are counted separately",
+			steps: []trackerStep{
+				{key: "a", fail: true, wantDelay: time.Second},
+				{key: "a", fail: true, wantDelay: 2 * time.Second},
+				{key: "b", wantDelay: 0},
+				{key: "b", fail: true, wantDelay: time.Second},
+			},
+		},
+		{
+			name: "failures are forgotten after lockout period",
+			steps: []trackerStep{
+				{key: "a", fail: true, wantDelay: time.Second},
+				{key: "a", fail: true, wantDelay: 2 * time.Second},
+				{advance: 10 * time.Minute, key: "a", fail: true, wantDelay: time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1600000000, 0)
+			tracker := NewTracker(policy)
+			tracker.now = func() time.Time { return now }
+			tracker.lastSweep = now
+			for i, step := range tt.steps {
+				now = now.Add(step.advance)
+				if !step.fail {
+					if got := tracker.Blocked(step.key); got != step.wantDelay {
+						t.Errorf("step %d: Blocked() = %s, want %s", i, got, step.wantDelay)
+					}
+					continue
+				}
+				delay, lockedOut := tracker.Fail(step.key)
+				if delay != step.wantDelay || lockedOut != step.wantLockedOut {
+					t.Errorf("step %d: Fail() = %s, %v, want %s, %v", i, delay, lockedOut, step.wantDelay, step.wantLockedOut)
+				}
+			}
+		})
+	}
+}
+
+func TestTrackerSweep(t *testing.T) {
+	policy := Policy{Threshold: 3, BaseDelay: time.Second, MaxDelay: time.Minute, Lockout: 10 * time.Minute}
+	now := time.Unix(1600000000, 0)
+	tracker := NewTracker(policy)
+	tracker.now = func() time.Time { return now }
+	tracker.lastSweep = now
+	tracker.Fail("old")
+	now = now.Add(5 * time.Minute)
+	tracker.Fail("recent")
+	now = now.Add(5 * time.Minute)
+	tracker.Fail("new")
+	if _, ok := tracker.entries["old"]; ok {
+		t.Error("entry without failures during lockout period isn't dropped")
+	}
+	if _, ok := tracker.entries["recent"]; !ok {
+		t.Error("entry with recent failure is dropped")
+	}
+}
@@ -0,0 +1,21 @@
+package logging
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+)
+
+type loggerKey struct{}
+
+// NewContext returns copy of ctx which carries request scoped logger
+func NewContext(ctx context.Context, logger *log.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns request scoped logger stored in ctx or standard logger when ctx doesn't carry one
+func FromContext(ctx context.Context) *log.Entry {
+	if logger, ok := ctx.Value(loggerKey{}).(*log.Entry); ok {
+		return logger
+	}
+	return log.NewEntry(log.StandardLogger())
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// redactedValue replaces values of secret fields
+const redactedValue = "[REDACTED]"
+
+// DefaultRedactedFields is list of field names which are never written to logs
+var DefaultRedactedFields = []string{
+	"password",
+	"refreshToken",
+	"accessToken",
+	"apiKey",
+	"token",
+	"authorization",
+	"secret",
+	"secretKey",
+}
+
+// RedactionHook is logrus hook which replaces values of secret fields before entry is written
+type RedactionHook struct {
+	fields map[string]struct{}
+}
+
+// NewRedactionHook return new RedactionHook instance, field names are matched case-insensitively
+func NewRedactionHook(fields []string) *RedactionHook {
+	hook := &RedactionHook{fields: make(map[string]struct{}, len(fields))}
+	for _, field := range fields {
+		hook.fields[strings.ToLower(field)] = struct{}{}
+	}
+	return hook
+}
+
+// Levels implements logrus.Hook
+func (h *RedactionHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (h *RedactionHook) Fire(entry *log.Entry) error {
+	for key := range entry.Data {
+		if _, ok := h.fields[strings.ToLower(key)]; ok {
+			entry.Data[key] = redactedValue
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes every message into separate .eml file in directory instead of sending it
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer return new FileMailer instance, directory is created when it doesn't exist
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("mail: can't create mail directory - %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send method write message into file named by time it was sent
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	if !headerSafe(msg.To) || !headerSafe(msg.Subject) {
+		return fmt.Errorf("mail: invalid message headers")
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.New().String())
+	if err := os.WriteFile(filepath.Join(m.dir, name), format(m.from, msg), 0600); err != nil {
+		return fmt.Errorf("mail: can't write message - %w", err)
+	}
+	return nil
+}
+
+// LogMailer writes messages into service log instead of sending them, message body is never
+// written because it carries tokens
+type LogMailer struct{}
+
+// Send method write recipient and subject of message into log
+func (LogMailer) Send(ctx context.Context, msg *Message) error {
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+	}).Info("mail: message isn't sent, log mailer is used")
+	return nil
+}
@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MailerSMTP sends messages through smtp server
+	MailerSMTP = "smtp"
+	// MailerFile writes messages into directory, it's intended for local development
+	MailerFile = "file"
+	// MailerLog writes recipient and subject of messages into service log, it's intended for local development
+	MailerLog = "log"
+)
+
+// Message represents plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages to users
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// format return message in rfc 5322 format
+func format(from string, msg *Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerSafe checks that value can't inject additional message headers
+func headerSafe(value string) bool {
+	return !strings.ContainsAny(value, "\r\n")
+}
@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+// SMTPMailer sends messages through smtp server, authentication is used when username is set
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer return new SMTPMailer instance, addr is host:port of smtp server
+func NewSMTPMailer(addr, username, password, from string) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("mail: invalid smtp address %q - %w", addr, err)
+	}
+	mailer := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return mailer, nil
+}
+
+// Send method deliver message to smtp server
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	if !headerSafe(msg.To) || !headerSafe(msg.Subject) {
+		return fmt.Errorf("mail: invalid message headers")
+	}
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, format(m.from, msg)); err != nil {
+		return fmt.Errorf("mail: can't send message - %w", err)
+	}
+	return nil
+}
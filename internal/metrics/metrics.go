@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+var (
+	// RPCRequests counts handled rpc by method and status code
+	RPCRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_requests_total",
+		Help: "Total number of handled gRPC requests.",
+	}, []string{"method", "code"})
+	// RPCDuration observes rpc handling latency by method
+	RPCDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_request_duration_seconds",
+		Help:    "gRPC request handling latency.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+	// RPCPanics counts panics recovered in rpc handlers
+	RPCPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_panics_total",
+		Help: "Total number of panics recovered in gRPC handlers.",
+	}, []string{"method"})
+
+	// CacheHits counts orders found in cache
+	CacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "order_cache_hits_total",
+		Help: "Total number of order cache hits.",
+	})
+	// CacheMisses counts orders which weren't found in cache
+	CacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "order_cache_misses_total",
+		Help: "Total number of order cache misses.",
+	})
+	// CacheSize shows number of orders stored in cache
+	CacheSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "order_cache_size",
+		Help: "Number of orders stored in cache.",
+	})
+	// CacheEvictions counts orders removed from cache to keep it within size limits
+	CacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "order_cache_evictions_total",
+		Help: "Total number of orders evicted from cache by size limits.",
+	})
+	// CacheExpirations counts orders removed from cache because their ttl passed
+	CacheExpirations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "order_cache_expirations_total",
+		Help: "Total number of orders expired in cache.",
+	})
+
+	// BrokerPublish counts published messages by broker and result
+	BrokerPublish = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "broker_publish_total",
+		Help: "Total number of messages published to broker.",
+	}, []string{"broker", "result"})
+	// ConsumerErrors counts messages which consumers failed to process
+	ConsumerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "broker_consumer_errors_total",
+		Help: "Total number of broker messages which failed processing.",
+	}, []string{"broker"})
+)
+
+// ObservePublish count broker publish result
+func ObservePublish(broker string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	BrokerPublish.WithLabelValues(broker, result).Inc()
+}
+
+// Handler return http handler which exposes metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -1,6 +1,9 @@
 package model
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Order type represent order structure in database
 type Order struct {
@@ -8,16 +11,87 @@ type Order struct {
 	OrderName   string `json:"orderName"`
 	OrderCost   int    `json:"orderCost"`
 	IsDelivered bool   `json:"isDelivered"`
+	// OwnerUUID is id of the user who created the order, it isn't sent to brokers and cache
+	OwnerUUID string `json:"-"`
 }
 
 // AuthUser struct represents user information
 type AuthUser struct {
-	UserUUID     string `json:"userID"`
-	UserName     string `json:"userName"`
-	Email        string `json:"email"`
-	Password     string `json:"password"`
-	RefreshToken string `json:"refreshToken"`
-	ExpiresIn    string `json:"expiresIn"`
+	UserUUID     string   `json:"userID"`
+	UserName     string   `json:"userName"`
+	Email        string   `json:"email"`
+	Password     string   `json:"password"`
+	RefreshToken string   `json:"refreshToken"`
+	ExpiresIn    string   `json:"expiresIn"`
+	Roles        []string `json:"roles"`
+	// EmailVerifiedAt is nil until user confirms email address
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty"`
+	// FailedLogins counts consecutive failed logins, logins are blocked until LockedUntil
+	FailedLogins int        `json:"-"`
+	LockedUntil  *time.Time `json:"-"`
+	// TOTPSecret is set on enrollment, second factor is required after TOTPEnabledAt
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"-"`
+}
+
+// Session struct represents user login on a device, device and peer
+// address are captured at login
+type Session struct {
+	ID         string
+	UserUUID   string
+	Device     string
+	PeerAddr   string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  *time.Time
+}
+
+// RefreshToken struct represents issued refresh token, tokens which were rotated
+// from the same login share FamilyID which is id of the session
+type RefreshToken struct {
+	ID        string
+	FamilyID  string
+	UserUUID  string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// Revocation struct represents revocation of access tokens with TokenID, tokens of the session
+// with SessionID or tokens of the user with UserUUID which were issued before IssuedBefore,
+// revocation is kept until ExpiresAt when all tokens it applies to are expired
+type Revocation struct {
+	TokenID      string    `json:"tokenID,omitempty"`
+	SessionID    string    `json:"sessionID,omitempty"`
+	UserUUID     string    `json:"userID,omitempty"`
+	IssuedBefore time.Time `json:"issuedBefore"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// APIKey struct represents long-lived key of service client acting on behalf of the user,
+// Prefix is visible part of the key which identifies it in listings
+type APIKey struct {
+	ID         string
+	UserUUID   string
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+}
+
+// OneTimeToken struct represents token which is sent to user to confirm an action, it can be used only once
+type OneTimeToken struct {
+	ID        string
+	UserUUID  string
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
 }
 
 // OrderMessage struct represents message to broker
@@ -30,6 +104,6 @@ func (order Order) MarshalBinary() ([]byte, error) {
 	return json.Marshal(order)
 }
 
-func (order Order) UnmarshalBinary(data []byte) error {
-	return json.Unmarshal(data, &order)
+func (order *Order) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, order)
 }
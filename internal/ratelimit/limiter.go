@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryAfterKey is metadata key which carries number of seconds to wait before retry
+const RetryAfterKey = "retry-after"
+
+// Limit describes token bucket, Rate is number of tokens added per second
+// and Burst is bucket capacity
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Limiter applies per method limits to callers
+type Limiter struct {
+	store        Store
+	defaultLimit Limit
+	limits       map[string]Limit
+}
+
+// NewLimiter return new Limiter instance, methods without own limit use defaultLimit
+func NewLimiter(store Store, defaultLimit Limit, limits map[string]Limit) *Limiter {
+	return &Limiter{store: store, defaultLimit: defaultLimit, limits: limits}
+}
+
+// Allow checks whether caller can execute method, it returns time to wait when limit is exceeded
+func (l *Limiter) Allow(ctx context.Context, method, caller string) (bool, time.Duration, error) {
+	limit, ok := l.limits[method]
+	if !ok {
+		limit = l.defaultLimit
+	}
+	return l.store.Take(ctx, method+"|"+caller, limit)
+}
+
+// ParseLimit parse limit in form "rate:burst", e.g. "0.5:10"
+func ParseLimit(value string) (Limit, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid limit %q, expected rate:burst", value)
+	}
+	rate, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || rate < 0 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid rate in %q", value)
+	}
+	burst, err := strconv.Atoi(parts[1])
+	if err != nil || burst < 1 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid burst in %q", value)
+	}
+	return Limit{Rate: rate, Burst: burst}, nil
+}
+
+// ParseMethodLimits parse per method limits in form "/package.Service/Method=rate:burst"
+func ParseMethodLimits(values []string) (map[string]Limit, error) {
+	limits := make(map[string]Limit, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("ratelimit: invalid method limit %q, expected method=rate:burst", value)
+		}
+		limit, err := ParseLimit(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		limits[parts[0]] = limit
+	}
+	return limits, nil
+}
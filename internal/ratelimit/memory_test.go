@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type takeStep struct {
+	advance   time.Duration
+	key       string
+	wantOK    bool
+	wantRetry time.Duration
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+		steps []takeStep
+	}{
+		{
+			name:  "burst then refill",
+			limit: Limit{Rate: 1, Burst: 2},
+			steps: []takeStep{
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: false, wantRetry: time.Second},
+				{advance: 500 * time.Millisecond, key: "a", wantOK: false, wantRetry: 500 * time.Millisecond},
+				{advance: 500 * time.Millisecond, key: "a", wantOK: true},
+				{advance: time.Hour, key: "a", wantOK: true},
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: false, wantRetry: time.Second},
+			},
+		},
+		{
+			name:  "keys have own buckets",
+			limit: Limit{Rate: 1, Burst: 1},
+			steps: []takeStep{
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: false, wantRetry: time.Second},
+				{key: "b", wantOK: true},
+			},
+		},
+		{
+			name:  "zero rate",
+			limit: Limit{Rate: 0, Burst: 1},
+			steps: []takeStep{
+				{key: "a", wantOK: true},
+				{advance: time.Minute, key: "a", wantOK: false, wantRetry: idleBucketTTL},
+				// bucket which wasn't used for idleBucketTTL is dropped and starts full
+				{advance: idleBucketTTL, key: "a", wantOK: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1600000000, 0)
+			store := NewMemoryStore()
+			store.now = func() time.Time { return now }
+			store.lastSweep = now
+			for i, step := range tt.steps {
+				now = now.Add(step.advance)
+				ok, retry, err := store.Take(context.Background(), step.key, tt.limit)
+				if err != nil {
+					t.Fatalf("step %d: Take() error = %v", i, err)
+				}
+				if ok != step.wantOK || retry != step.wantRetry {
+					t.Errorf("step %d: Take() = %v, %s, want %v, %s", i, ok, retry, step.wantOK, step.wantRetry)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	store.lastSweep = now
+	limit := Limit{Rate: 1, Burst: 1}
+	_, _, _ = store.Take(context.Background(), "idle", limit)
+	now = now.Add(idleBucketTTL / 2)
+	_, _, _ = store.Take(context.Background(), "active", limit)
+	now = now.Add(idleBucketTTL / 2)
+	_, _, _ = store.Take(context.Background(), "active", limit)
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("idle bucket isn't dropped")
+	}
+	if _, ok := store.buckets["active"]; !ok {
+		t.Error("active bucket is dropped")
+	}
+}
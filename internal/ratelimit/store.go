@@ -0,0 +1,14 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps token buckets state, implementations shared between
+// service replicas can be added behind this interface
+type Store interface {
+	// Take remove one token from the bucket identified by key, when bucket is empty
+	// it returns false and time after which the token will be available
+	Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// apiKeyTouchInterval limits how often last usage time of api key is written
+const apiKeyTouchInterval = "1 minute"
+
+// SaveAPIKey method saves issued api key into postgres database
+func (rps PostgresRepository) SaveAPIKey(ctx context.Context, key *model.APIKey) (err error) {
+	ctx, span := startSpan(ctx, "api_keys.insert")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"keyID":  key.ID,
+		"userID": key.UserUUID,
+		"prefix": key.Prefix,
+	}).Debugf("postgres repository: save api key")
+	_, err = rps.DBconn.Exec(ctx, `insert into api_keys (id, useruuid, name, prefix, key_hash, scopes, expires_at)
+		values ($1, $2, $3, $4, $5, $6, $7)`, key.ID, key.UserUUID, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("repository: can't save api key - %w", err)
+	}
+	return nil
+}
+
+// GetAPIKeyByPrefix method returns api key from postgres database with selection by its visible prefix
+func (rps PostgresRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (_ *model.APIKey, err error) {
+	ctx, span := startSpan(ctx, "api_keys.select")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	key, err := scanAPIKey(rps.DBconn.QueryRow(ctx, `select `+apiKeyColumns+` from api_keys
+		where prefix=$1`, prefix))
+	if err != nil {
+		return nil, fmt.Errorf("repository: can't get api key - %w", err)
+	}
+	return key, nil
+}
+
+// GetUserAPIKeys method returns api keys of the user which are not revoked
+func (rps PostgresRepository) GetUserAPIKeys(ctx context.Context, userUUID string) (_ []model.APIKey, err error) {
+	ctx, span := startSpan(ctx, "api_keys.select")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("postgres repository: get user api keys")
+	rows, err := rps.DBconn.Query(ctx, `select `+apiKeyColumns+` from api_keys
+		where useruuid=$1 and revoked_at is null
+		order by created_at desc`, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("repository: can't get user api keys - %w", err)
+	}
+	defer rows.Close()
+	var keys []model.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repository: can't get user api keys - %w", err)
+		}
+		keys = append(keys, *key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: can't get user api keys - %w", err)
+	}
+	return keys, nil
+}
+
+// TouchAPIKey method updates last usage time of api key, it's written at most once per apiKeyTouchInterval
+func (rps PostgresRepository) TouchAPIKey(ctx context.Context, keyID string) (err error) {
+	ctx, span := startSpan(ctx, "api_keys.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	_, err = rps.DBconn.Exec(ctx, `update api_keys set last_used_at=now()
+		where id=$1 and (last_used_at is null or last_used_at < now() - interval '`+apiKeyTouchInterval+`')`, keyID)
+	if err != nil {
+		return fmt.Errorf("repository: can't touch api key - %w", err)
+	}
+	return nil
+}
+
+// RevokeAPIKey method revokes api key of the user, it returns false when user has no such active key
+func (rps PostgresRepository) RevokeAPIKey(ctx context.Context, keyID, userUUID string) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "api_keys.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"keyID":  keyID,
+		"userID": userUUID,
+	}).Debugf("postgres repository: revoke api key")
+	tag, err := rps.DBconn.Exec(ctx, `update api_keys set revoked_at=now()
+		where id=$1 and useruuid=$2 and revoked_at is null`, keyID, userUUID)
+	if err != nil {
+		return false, fmt.Errorf("repository: can't revoke api key - %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RevokeUserAPIKeys method revokes all active api keys of the user and returns their number
+func (rps PostgresRepository) RevokeUserAPIKeys(ctx context.Context, userUUID string) (_ int, err error) {
+	ctx, span := startSpan(ctx, "api_keys.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithField("userID", userUUID).Debugf("postgres repository: revoke user api keys")
+	tag, err := rps.DBconn.Exec(ctx, `update api_keys set revoked_at=now()
+		where useruuid=$1 and revoked_at is null`, userUUID)
+	if err != nil {
+		return 0, fmt.Errorf("repository: can't revoke user api keys - %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// apiKeyColumns lists api_keys columns in the order they are read by scanAPIKey
+const apiKeyColumns = `id, useruuid, name, prefix, key_hash, scopes, created_at, last_used_at, expires_at, revoked_at`
+
+func scanAPIKey(row pgx.Row) (*model.APIKey, error) {
+	var key model.APIKey
+	err := row.Scan(&key.ID, &key.UserUUID, &key.Name, &key.Prefix, &key.KeyHash, &key.Scopes,
+		&key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt, &key.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetAuthUserByIdentity method returns user linked to identity of external provider,
+// ErrNotFound is returned when identity isn't linked yet
+func (rps PostgresRepository) GetAuthUserByIdentity(ctx context.Context, issuer, subject string) (_ *model.AuthUser, err error) {
+	ctx, span := startSpan(ctx, "authusers.select")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"issuer":  issuer,
+		"subject": subject,
+	}).Debugf("postgres repository: get authUser by external identity")
+	authUser, err := scanAuthUser(rps.DBconn.QueryRow(ctx, `select `+authUserColumns+` from authusers
+		where useruuid=(select useruuid from external_identities where issuer=$1 and subject=$2)`, issuer, subject))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("repository: can't get authUser by external identity - %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: can't get authUser by external identity - %w", err)
+	}
+	return authUser, nil
+}
+
+// LinkIdentity method links identity of external provider to the user, identity which is
+// already linked is kept
+func (rps PostgresRepository) LinkIdentity(ctx context.Context, issuer, subject, userUUID string) (err error) {
+	ctx, span := startSpan(ctx, "external_identities.insert")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"issuer":  issuer,
+		"subject": subject,
+		"userID":  userUUID,
+	}).Debugf("postgres repository: link external identity")
+	_, err = rps.DBconn.Exec(ctx, `insert into external_identities (issuer, subject, useruuid)
+		values ($1, $2, $3)
+		on conflict (issuer, subject) do nothing`, issuer, subject, userUUID)
+	if err != nil {
+		return fmt.Errorf("repository: can't link external identity - %w", err)
+	}
+	return nil
+}
+
+// CreateExternalAuthUser method saves user without password whose email is verified by external provider
+// and links identity to the user in one transaction, ErrAlreadyExists is returned when email is taken
+func (rps PostgresRepository) CreateExternalAuthUser(ctx context.Context, authUser *model.AuthUser, issuer, subject string) (err error) {
+	ctx, span := startSpan(ctx, "authusers.insert")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userName": authUser.UserName,
+		"issuer":   issuer,
+		"subject":  subject,
+	}).Debugf("postgres repository: create external authUser")
+	err = rps.inTx(ctx, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, `insert into authusers (username, email, password, email_verified_at)
+			values($1, $2, '', now()) returning useruuid`, authUser.UserName, authUser.Email).Scan(&authUser.UserUUID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `insert into external_identities (issuer, subject, useruuid)
+			values ($1, $2, $3)`, issuer, subject, authUser.UserUUID)
+		return err
+	})
+	if isUniqueViolation(err) {
+		return fmt.Errorf("repository: can't create external authUser - %w", ErrAlreadyExists)
+	}
+	if err != nil {
+		return fmt.Errorf("repository: can't create external authUser - %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// RecordLoginFailure method increments failed logins counter of the user and returns its new value,
+// counter starts again when there were no failures during window
+func (rps PostgresRepository) RecordLoginFailure(ctx context.Context, userUUID string, window time.Duration) (_ int, err error) {
+	ctx, span := startSpan(ctx, "authusers.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("postgres repository: record authUser login failure")
+	var failures int
+	err = rps.DBconn.QueryRow(ctx, `update authusers
+		set failed_logins=case when last_failed_login_at>$2 then failed_logins+1 else 1 end,
+			last_failed_login_at=now()
+		where useruuid=$1
+		returning failed_logins`, userUUID, time.Now().Add(-window)).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("repository: can't record login failure - %w", err)
+	}
+	return failures, nil
+}
+
+// LockAuthUser method blocks logins of the user until given time
+func (rps PostgresRepository) LockAuthUser(ctx context.Context, userUUID string, until time.Time) (err error) {
+	ctx, span := startSpan(ctx, "authusers.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID": userUUID,
+		"until":  until,
+	}).Debugf("postgres repository: lock authUser")
+	_, err = rps.DBconn.Exec(ctx, `update authusers
+		set locked_until=$2
+		where useruuid=$1`, userUUID, until)
+	if err != nil {
+		return fmt.Errorf("repository: can't lock authUser - %w", err)
+	}
+	return nil
+}
+
+// UnlockAuthUser method resets failed logins counter and allows logins of the user
+func (rps PostgresRepository) UnlockAuthUser(ctx context.Context, userUUID string) (err error) {
+	ctx, span := startSpan(ctx, "authusers.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("postgres repository: unlock authUser")
+	_, err = rps.DBconn.Exec(ctx, `update authusers
+		set failed_logins=0, locked_until=null
+		where useruuid=$1`, userUUID)
+	if err != nil {
+		return fmt.Errorf("repository: can't unlock authUser - %w", err)
+	}
+	return nil
+}
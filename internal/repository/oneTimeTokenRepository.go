@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
+	log "github.com/sirupsen/logrus"
+)
+
+// SaveOneTimeToken method saves issued one-time token into postgres database
+func (rps PostgresRepository) SaveOneTimeToken(ctx context.Context, token *model.OneTimeToken) (err error) {
+	ctx, span := startSpan(ctx, "one_time_tokens.insert")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"tokenID": token.ID,
+		"userID":  token.UserUUID,
+		"purpose": token.Purpose,
+	}).Debugf("postgres repository: save one-time token")
+	_, err = rps.DBconn.Exec(ctx, `insert into one_time_tokens (id, useruuid, purpose, token_hash, expires_at)
+		values ($1, $2, $3, $4, $5)`, token.ID, token.UserUUID, token.Purpose, token.TokenHash, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("repository: can't save one-time token - %w", err)
+	}
+	return nil
+}
+
+// UseOneTimeToken method marks one-time token as used, it returns false when token doesn't exist,
+// was issued for other purpose, has different hash, is expired or was already used
+func (rps PostgresRepository) UseOneTimeToken(ctx context.Context, tokenID, purpose, tokenHash string) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "one_time_tokens.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"tokenID": tokenID,
+		"purpose": purpose,
+	}).Debugf("postgres repository: use one-time token")
+	tag, err := rps.DBconn.Exec(ctx, `update one_time_tokens
+		set used_at=now()
+		where id=$1 and purpose=$2 and token_hash=$3 and used_at is null and expires_at > now()`, tokenID, purpose, tokenHash)
+	if err != nil {
+		return false, fmt.Errorf("repository: can't use one-time token - %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// DeleteOneTimeTokens method deletes unused one-time tokens of the user issued for purpose
+func (rps PostgresRepository) DeleteOneTimeTokens(ctx context.Context, userUUID, purpose string) (err error) {
+	ctx, span := startSpan(ctx, "one_time_tokens.delete")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID":  userUUID,
+		"purpose": purpose,
+	}).Debugf("postgres repository: delete one-time tokens")
+	_, err = rps.DBconn.Exec(ctx, `delete from one_time_tokens
+		where useruuid=$1 and purpose=$2 and used_at is null`, userUUID, purpose)
+	if err != nil {
+		return fmt.Errorf("repository: can't delete one-time tokens - %w", err)
+	}
+	return nil
+}
@@ -2,40 +2,56 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
 	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
 
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	log "github.com/sirupsen/logrus"
 )
 
+// uniqueViolationCode is postgres error code of unique constraint violation
+const uniqueViolationCode = "23505"
+
 // PostgresRepository type replies for accessing to postgres database
 type PostgresRepository struct {
 	DBconn *pgxpool.Pool
 }
 
 // Save save Order object into postgresql database
-func (rps PostgresRepository) Save(ctx context.Context, order *model.Order) error {
-	log.WithFields(log.Fields{
+func (rps PostgresRepository) Save(ctx context.Context, order *model.Order) (err error) {
+	ctx, span := startSpan(ctx, "orders.insert")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
 		"orderID":   order.OrderID,
 		"orderName": order.OrderName,
 	}).Debugf("repository: create order")
-	_, err := rps.DBconn.Exec(ctx, `insert into orders (orderID, orderName, orderCost, isDelivered) 
-		values ($1, $2, $3, $4)`, order.OrderID, order.OrderName, order.OrderCost, order.IsDelivered)
+	_, err = rps.DBconn.Exec(ctx, `insert into orders (orderID, orderName, orderCost, isDelivered, owner_uuid) 
+		values ($1, $2, $3, $4, nullif($5, '')::uuid)`, order.OrderID, order.OrderName, order.OrderCost, order.IsDelivered, order.OwnerUUID)
 	if err != nil {
-		return fmt.Errorf("postgres repository: can't save order", err)
+		return fmt.Errorf("postgres repository: can't save order - %w", err)
 	}
 	return nil
 }
 
 // Get method returns Order object from postgresql database
 // with selection by OrderID
-func (rps PostgresRepository) Get(ctx context.Context, orderID string) (*model.Order, error) {
-	log.WithFields(log.Fields{
+func (rps PostgresRepository) Get(ctx context.Context, orderID string) (_ *model.Order, err error) {
+	ctx, span := startSpan(ctx, "orders.select")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
 		"orderID": orderID,
 	}).Debugf("repository: get order")
 	var order model.Order
-	err := rps.DBconn.QueryRow(ctx, `select orderID, orderName, orderCost, isDelivered from orders 
+	err = rps.DBconn.QueryRow(ctx, `select orderID, orderName, orderCost, isDelivered from orders 
 		where orderID=$1`, orderID).Scan(&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered)
 	if err != nil {
 		return nil, fmt.Errorf("postgres repository: can't get order - %w", err)
@@ -45,12 +61,16 @@ func (rps PostgresRepository) Get(ctx context.Context, orderID string) (*model.O
 
 // Update method update Order object from postgresql database
 // with selection by OrderID
-func (rps PostgresRepository) Update(ctx context.Context, order *model.Order) error {
-	log.WithFields(log.Fields{
+func (rps PostgresRepository) Update(ctx context.Context, order *model.Order) (err error) {
+	ctx, span := startSpan(ctx, "orders.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
 		"orderID":   order.OrderID,
 		"orderName": order.OrderName,
 	}).Debugf("postgres repository: update order")
-	_, err := rps.DBconn.Exec(ctx, `update orders
+	_, err = rps.DBconn.Exec(ctx, `update orders
 		set orderName=$2, orderCost=$3, isDelivered=$4
 		where orderID=$1`, order.OrderID, order.OrderName, order.OrderCost, order.IsDelivered)
 	if err != nil {
@@ -61,11 +81,15 @@ func (rps PostgresRepository) Update(ctx context.Context, order *model.Order) er
 
 // Delete method delete Order object from postgresql database
 // with selection by OrderID
-func (rps PostgresRepository) Delete(ctx context.Context, orderID string) error {
-	log.WithFields(log.Fields{
+func (rps PostgresRepository) Delete(ctx context.Context, orderID string) (err error) {
+	ctx, span := startSpan(ctx, "orders.delete")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
 		"orderID": orderID,
 	}).Debugf("postgres repository: delete order")
-	_, err := rps.DBconn.Exec(ctx, "delete from orders where orderID=$1", orderID)
+	_, err = rps.DBconn.Exec(ctx, "delete from orders where orderID=$1", orderID)
 	if err != nil {
 		return fmt.Errorf("repository: can't delete order - %w", err)
 	}
@@ -74,13 +98,20 @@ func (rps PostgresRepository) Delete(ctx context.Context, orderID string) error
 
 // SaveAuthUser method saves authentication info about user into
 // postgres database
-func (rps PostgresRepository) SaveAuthUser(ctx context.Context, authUser *model.AuthUser) error {
-	log.WithFields(log.Fields{
+func (rps PostgresRepository) SaveAuthUser(ctx context.Context, authUser *model.AuthUser) (err error) {
+	ctx, span := startSpan(ctx, "authusers.insert")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
 		"userID":   authUser.UserUUID,
 		"userName": authUser.UserName,
 	}).Debugf("postgres repository: save authUser")
-	_, err := rps.DBconn.Exec(ctx, `insert into authusers (username, email, password) 
-		values($1, $2, $3)`, authUser.UserName, authUser.Email, authUser.Password)
+	err = rps.DBconn.QueryRow(ctx, `insert into authusers (username, email, password) 
+		values($1, $2, $3) returning useruuid`, authUser.UserName, authUser.Email, authUser.Password).Scan(&authUser.UserUUID)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("postgres repository: can't save authUser - %w", ErrAlreadyExists)
+	}
 	if err != nil {
 		return fmt.Errorf("postgres repository: can't save authUser - %w", err)
 	}
@@ -88,52 +119,121 @@ func (rps PostgresRepository) SaveAuthUser(ctx context.Context, authUser *model.
 }
 
 // GetAuthUser method returns authentication info about user from
-// postgres database with selection by email
-func (rps PostgresRepository) GetAuthUser(ctx context.Context, email string) (*model.AuthUser, error) {
-	log.WithFields(log.Fields{
+// postgres database with selection by email, ErrNotFound is returned when there is no such user
+func (rps PostgresRepository) GetAuthUser(ctx context.Context, email string) (_ *model.AuthUser, err error) {
+	ctx, span := startSpan(ctx, "authusers.select")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
 		"email": email,
 	}).Debugf("postgres repository: get authUser by email")
-	var authUser model.AuthUser
-	err := rps.DBconn.QueryRow(ctx, `select useruuid, username, email, password from authusers
-		where email=$1`, email).Scan(&authUser.UserUUID, &authUser.UserName, &authUser.Email, &authUser.Password)
+	authUser, err := scanAuthUser(rps.DBconn.QueryRow(ctx, `select `+authUserColumns+` from authusers
+		where lower(email)=lower($1)`, email))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("repository: can't get authUser - %w", ErrNotFound)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("repository: can't get authUser - %w", err)
 	}
-	return &authUser, nil
+	return authUser, nil
 }
 
 // GetAuthUserByID method returns authentication info about user from
 // postgres database with selection by id
-func (rps PostgresRepository) GetAuthUserByID(ctx context.Context, userUUID string) (*model.AuthUser, error) {
-	log.WithFields(log.Fields{
+func (rps PostgresRepository) GetAuthUserByID(ctx context.Context, userUUID string) (_ *model.AuthUser, err error) {
+	ctx, span := startSpan(ctx, "authusers.select")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
 		"userID": userUUID,
 	}).Debugf("postgres repository: get authUser by id")
-	var authUser model.AuthUser
-	err := rps.DBconn.QueryRow(ctx, `select useruuid, username, email, password, refreshtoken from authusers
-		where useruuid=$1`, userUUID).Scan(&authUser.UserUUID, &authUser.UserName, &authUser.Email, &authUser.Password, &authUser.RefreshToken)
+	authUser, err := scanAuthUser(rps.DBconn.QueryRow(ctx, `select `+authUserColumns+` from authusers
+		where useruuid=$1`, userUUID))
 	if err != nil {
 		return nil, fmt.Errorf("repository: can't get authUser by ID - %w", err)
 	}
+	return authUser, nil
+}
+
+// authUserColumns lists authusers columns in the order they are read by scanAuthUser
+const authUserColumns = `useruuid, username, email, password, roles, email_verified_at, failed_logins, locked_until,
+	totp_secret, totp_enabled_at`
+
+func scanAuthUser(row pgx.Row) (*model.AuthUser, error) {
+	var authUser model.AuthUser
+	err := row.Scan(&authUser.UserUUID, &authUser.UserName, &authUser.Email, &authUser.Password, &authUser.Roles,
+		&authUser.EmailVerifiedAt, &authUser.FailedLogins, &authUser.LockedUntil, &authUser.TOTPSecret, &authUser.TOTPEnabledAt)
+	if err != nil {
+		return nil, err
+	}
 	return &authUser, nil
 }
 
-// UpdateAuthUser is method to set refresh token into authuser info
-func (rps PostgresRepository) UpdateAuthUser(ctx context.Context, email, refreshToken string) error {
-	log.WithFields(log.Fields{
-		"email":        email,
-		"refreshToken": refreshToken,
-	}).Debugf("postgres repository: update authUser")
-	_, err := rps.DBconn.Exec(ctx, `update authusers
-		set refreshtoken=$2
-		where email=$1`, email, refreshToken)
+// VerifyEmail method marks email of the user as verified
+func (rps PostgresRepository) VerifyEmail(ctx context.Context, userUUID string) (err error) {
+	ctx, span := startSpan(ctx, "authusers.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("postgres repository: verify authUser email")
+	_, err = rps.DBconn.Exec(ctx, `update authusers
+		set email_verified_at=now()
+		where useruuid=$1 and email_verified_at is null`, userUUID)
+	if err != nil {
+		return fmt.Errorf("repository: can't verify authUser email - %w", err)
+	}
+	return nil
+}
+
+// UpdatePassword is method to replace user password hash
+func (rps PostgresRepository) UpdatePassword(ctx context.Context, userUUID, passwordHash string) (err error) {
+	ctx, span := startSpan(ctx, "authusers.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("postgres repository: update authUser password")
+	_, err = rps.DBconn.Exec(ctx, `update authusers
+		set password=$2
+		where useruuid=$1`, userUUID, passwordHash)
 	if err != nil {
-		return fmt.Errorf("repository: can't update authUser - %w", err)
+		return fmt.Errorf("repository: can't update authUser password - %w", err)
 	}
 	return nil
 }
 
-// CloseDBConnection is using to close current postgres database connection
+// CloseDBConnection is using to close current postgres database connection,
+// it waits until all acquired connections are released
 func (rps PostgresRepository) CloseDBConnection() error {
+	if rps.DBconn == nil {
+		return fmt.Errorf("repository: database connection wasn't established")
+	}
 	rps.DBconn.Close()
-	return fmt.Errorf("repository: database connection closed")
+	return nil
+}
+
+// isUniqueViolation checks whether err is caused by unique constraint of the table
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode
+}
+
+// inTx runs fn in transaction which is committed when fn succeeds
+func (rps PostgresRepository) inTx(ctx context.Context, fn func(pgx.Tx) error) error {
+	tx, err := rps.DBconn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			logging.FromContext(ctx).Errorf("postgres repository: rollback failed - %v", rbErr)
+		}
+		return err
+	}
+	return tx.Commit(ctx)
 }
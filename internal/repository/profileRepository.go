@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// UpdateProfile method replaces user name and email of the user, email verification
+// is dropped when email is changed
+func (rps PostgresRepository) UpdateProfile(ctx context.Context, userUUID, userName, email string) (err error) {
+	ctx, span := startSpan(ctx, "authusers.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID":   userUUID,
+		"userName": userName,
+	}).Debugf("postgres repository: update authUser profile")
+	_, err = rps.DBconn.Exec(ctx, `update authusers
+		set username=$2,
+			email_verified_at=case when email=$3 then email_verified_at end,
+			email=$3
+		where useruuid=$1`, userUUID, userName, email)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("repository: can't update authUser profile - %w", ErrAlreadyExists)
+	}
+	if err != nil {
+		return fmt.Errorf("repository: can't update authUser profile - %w", err)
+	}
+	return nil
+}
+
+// DeleteAuthUser method erases personal data of the user: credentials and contacts are replaced,
+// sessions, tokens and api keys are revoked, external identities are unlinked and orders of the
+// user lose their owner. The row of the user is kept, so its id isn't reused
+func (rps PostgresRepository) DeleteAuthUser(ctx context.Context, userUUID string) (err error) {
+	ctx, span := startSpan(ctx, "authusers.delete")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("postgres repository: delete authUser")
+	err = rps.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `update authusers
+			set username='', email='deleted-'||useruuid||'@invalid', password='', roles='{}',
+				email_verified_at=null, failed_logins=0, locked_until=null,
+				totp_secret='', totp_enabled_at=null, totp_last_step=0, deleted_at=now()
+			where useruuid=$1`, userUUID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `update sessions
+			set device='', peer_addr='', revoked_at=coalesce(revoked_at, now())
+			where useruuid=$1`, userUUID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `update refresh_tokens set revoked_at=now()
+			where useruuid=$1 and revoked_at is null`, userUUID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `update api_keys set revoked_at=now()
+			where useruuid=$1 and revoked_at is null`, userUUID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `delete from one_time_tokens where useruuid=$1`, userUUID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `delete from recovery_codes where useruuid=$1`, userUUID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `delete from external_identities where useruuid=$1`, userUUID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `update orders set owner_uuid=null where owner_uuid=$1`, userUUID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("repository: can't delete authUser - %w", err)
+	}
+	return nil
+}
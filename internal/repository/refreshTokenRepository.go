@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
+	log "github.com/sirupsen/logrus"
+)
+
+// SaveRefreshToken method saves issued refresh token into postgres database
+func (rps PostgresRepository) SaveRefreshToken(ctx context.Context, token *model.RefreshToken) (err error) {
+	ctx, span := startSpan(ctx, "refresh_tokens.insert")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"tokenID":  token.ID,
+		"familyID": token.FamilyID,
+		"userID":   token.UserUUID,
+	}).Debugf("postgres repository: save refresh token")
+	_, err = rps.DBconn.Exec(ctx, `insert into refresh_tokens (id, family_id, useruuid, token_hash, expires_at)
+		values ($1, $2, $3, $4, $5)`, token.ID, token.FamilyID, token.UserUUID, token.TokenHash, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("repository: can't save refresh token - %w", err)
+	}
+	return nil
+}
+
+// GetRefreshToken method returns refresh token info from postgres database with selection by token id
+func (rps PostgresRepository) GetRefreshToken(ctx context.Context, tokenID string) (_ *model.RefreshToken, err error) {
+	ctx, span := startSpan(ctx, "refresh_tokens.select")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"tokenID": tokenID,
+	}).Debugf("postgres repository: get refresh token")
+	var token model.RefreshToken
+	err = rps.DBconn.QueryRow(ctx, `select id, family_id, useruuid, token_hash, created_at, expires_at, used_at, revoked_at
+		from refresh_tokens where id=$1`, tokenID).Scan(&token.ID, &token.FamilyID, &token.UserUUID, &token.TokenHash,
+		&token.CreatedAt, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt)
+	if err != nil {
+		return nil, fmt.Errorf("repository: can't get refresh token - %w", err)
+	}
+	return &token, nil
+}
+
+// UseRefreshToken method marks refresh token as used, it returns false when token
+// was already used or revoked
+func (rps PostgresRepository) UseRefreshToken(ctx context.Context, tokenID string) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "refresh_tokens.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"tokenID": tokenID,
+	}).Debugf("postgres repository: use refresh token")
+	tag, err := rps.DBconn.Exec(ctx, `update refresh_tokens
+		set used_at=now()
+		where id=$1 and used_at is null and revoked_at is null`, tokenID)
+	if err != nil {
+		return false, fmt.Errorf("repository: can't use refresh token - %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
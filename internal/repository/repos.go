@@ -2,7 +2,16 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"github.com/EgorBessonov/gRPC/internal/model"
+	"time"
+)
+
+var (
+	// ErrAlreadyExists is returned when saved entity conflicts with existing one, e.g. user with the same email
+	ErrAlreadyExists = errors.New("repository: already exists")
+	// ErrNotFound is returned when requested entity doesn't exist
+	ErrNotFound = errors.New("repository: not found")
 )
 
 // Repository interface represent repository behavior
@@ -14,6 +23,40 @@ type Repository interface {
 	SaveAuthUser(context.Context, *model.AuthUser) error
 	GetAuthUser(context.Context, string) (*model.AuthUser, error)
 	GetAuthUserByID(context.Context, string) (*model.AuthUser, error)
-	UpdateAuthUser(ctx context.Context, email, refreshToken string) error
+	GetAuthUserByIdentity(ctx context.Context, issuer, subject string) (*model.AuthUser, error)
+	LinkIdentity(ctx context.Context, issuer, subject, userUUID string) error
+	CreateExternalAuthUser(ctx context.Context, authUser *model.AuthUser, issuer, subject string) error
+	UpdatePassword(ctx context.Context, userUUID, passwordHash string) error
+	UpdateProfile(ctx context.Context, userUUID, userName, email string) error
+	DeleteAuthUser(ctx context.Context, userUUID string) error
+	VerifyEmail(ctx context.Context, userUUID string) error
+	RecordLoginFailure(ctx context.Context, userUUID string, window time.Duration) (int, error)
+	LockAuthUser(ctx context.Context, userUUID string, until time.Time) error
+	UnlockAuthUser(ctx context.Context, userUUID string) error
+	SetTOTPSecret(ctx context.Context, userUUID, secret string) error
+	EnableTOTP(ctx context.Context, userUUID string, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(ctx context.Context, userUUID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userUUID, codeHash string) (bool, error)
+	SaveOneTimeToken(context.Context, *model.OneTimeToken) error
+	UseOneTimeToken(ctx context.Context, tokenID, purpose, tokenHash string) (bool, error)
+	DeleteOneTimeTokens(ctx context.Context, userUUID, purpose string) error
+	SaveRefreshToken(context.Context, *model.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenID string) (*model.RefreshToken, error)
+	UseRefreshToken(ctx context.Context, tokenID string) (bool, error)
+	CreateSession(context.Context, *model.Session) error
+	GetSession(ctx context.Context, sessionID string) (*model.Session, error)
+	GetUserSessions(ctx context.Context, userUUID string) ([]model.Session, error)
+	TouchSession(ctx context.Context, sessionID string) error
+	RevokeSession(ctx context.Context, sessionID string) error
+	RevokeUserSessions(ctx context.Context, userUUID string) error
+	RevokeOtherSessions(ctx context.Context, userUUID, keepSessionID string) ([]string, error)
+	SaveRevocation(context.Context, *model.Revocation) error
+	GetRevocations(context.Context) ([]model.Revocation, error)
+	SaveAPIKey(context.Context, *model.APIKey) error
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error)
+	GetUserAPIKeys(ctx context.Context, userUUID string) ([]model.APIKey, error)
+	TouchAPIKey(ctx context.Context, keyID string) error
+	RevokeAPIKey(ctx context.Context, keyID, userUUID string) (bool, error)
+	RevokeUserAPIKeys(ctx context.Context, userUUID string) (int, error)
 	CloseDBConnection() error
 }
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// SaveRevocation method saves access token revocation into postgres database,
+// revocations which are no longer needed are removed at the same time
+func (rps PostgresRepository) SaveRevocation(ctx context.Context, revocation *model.Revocation) (err error) {
+	ctx, span := startSpan(ctx, "token_revocations.insert")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"tokenID":   revocation.TokenID,
+		"sessionID": revocation.SessionID,
+		"userID":    revocation.UserUUID,
+	}).Debugf("postgres repository: save token revocation")
+	err = rps.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `delete from token_revocations where expires_at < now()`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `insert into token_revocations (token_id, session_id, useruuid, issued_before, expires_at)
+			values (nullif($1, ''), nullif($2, '')::uuid, nullif($3, '')::uuid, $4, $5)`,
+			revocation.TokenID, revocation.SessionID, revocation.UserUUID, revocation.IssuedBefore, revocation.ExpiresAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("repository: can't save token revocation - %w", err)
+	}
+	return nil
+}
+
+// GetRevocations method returns access token revocations which are not expired yet
+func (rps PostgresRepository) GetRevocations(ctx context.Context) (_ []model.Revocation, err error) {
+	ctx, span := startSpan(ctx, "token_revocations.select")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	rows, err := rps.DBconn.Query(ctx, `select coalesce(token_id, ''), coalesce(session_id::text, ''),
+		coalesce(useruuid::text, ''), issued_before, expires_at
+		from token_revocations where expires_at > now()`)
+	if err != nil {
+		return nil, fmt.Errorf("repository: can't get token revocations - %w", err)
+	}
+	defer rows.Close()
+	var revocations []model.Revocation
+	for rows.Next() {
+		var revocation model.Revocation
+		err = rows.Scan(&revocation.TokenID, &revocation.SessionID, &revocation.UserUUID,
+			&revocation.IssuedBefore, &revocation.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("repository: can't get token revocations - %w", err)
+		}
+		revocations = append(revocations, revocation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: can't get token revocations - %w", err)
+	}
+	return revocations, nil
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateSession method saves new login session into postgres database
+func (rps PostgresRepository) CreateSession(ctx context.Context, session *model.Session) (err error) {
+	ctx, span := startSpan(ctx, "sessions.insert")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"sessionID": session.ID,
+		"userID":    session.UserUUID,
+	}).Debugf("postgres repository: create session")
+	_, err = rps.DBconn.Exec(ctx, `insert into sessions (id, useruuid, device, peer_addr)
+		values ($1, $2, $3, $4)`, session.ID, session.UserUUID, session.Device, session.PeerAddr)
+	if err != nil {
+		return fmt.Errorf("repository: can't create session - %w", err)
+	}
+	return nil
+}
+
+// GetSession method returns session from postgres database with selection by id
+func (rps PostgresRepository) GetSession(ctx context.Context, sessionID string) (_ *model.Session, err error) {
+	ctx, span := startSpan(ctx, "sessions.select")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"sessionID": sessionID,
+	}).Debugf("postgres repository: get session")
+	var session model.Session
+	err = rps.DBconn.QueryRow(ctx, `select id, useruuid, device, peer_addr, created_at, last_used_at, revoked_at
+		from sessions where id=$1`, sessionID).Scan(&session.ID, &session.UserUUID, &session.Device, &session.PeerAddr,
+		&session.CreatedAt, &session.LastUsedAt, &session.RevokedAt)
+	if err != nil {
+		return nil, fmt.Errorf("repository: can't get session - %w", err)
+	}
+	return &session, nil
+}
+
+// GetUserSessions method returns active sessions of the user
+func (rps PostgresRepository) GetUserSessions(ctx context.Context, userUUID string) (_ []model.Session, err error) {
+	ctx, span := startSpan(ctx, "sessions.select")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("postgres repository: get user sessions")
+	rows, err := rps.DBconn.Query(ctx, `select id, useruuid, device, peer_addr, created_at, last_used_at, revoked_at
+		from sessions where useruuid=$1 and revoked_at is null
+		order by last_used_at desc`, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("repository: can't get user sessions - %w", err)
+	}
+	defer rows.Close()
+	var sessions []model.Session
+	for rows.Next() {
+		var session model.Session
+		err = rows.Scan(&session.ID, &session.UserUUID, &session.Device, &session.PeerAddr,
+			&session.CreatedAt, &session.LastUsedAt, &session.RevokedAt)
+		if err != nil {
+			return nil, fmt.Errorf("repository: can't get user sessions - %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: can't get user sessions - %w", err)
+	}
+	return sessions, nil
+}
+
+// TouchSession method updates last usage time of the session
+func (rps PostgresRepository) TouchSession(ctx context.Context, sessionID string) (err error) {
+	ctx, span := startSpan(ctx, "sessions.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	_, err = rps.DBconn.Exec(ctx, `update sessions set last_used_at=now() where id=$1`, sessionID)
+	if err != nil {
+		return fmt.Errorf("repository: can't touch session - %w", err)
+	}
+	return nil
+}
+
+// RevokeSession method revokes session and all its refresh tokens
+func (rps PostgresRepository) RevokeSession(ctx context.Context, sessionID string) (err error) {
+	ctx, span := startSpan(ctx, "sessions.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"sessionID": sessionID,
+	}).Debugf("postgres repository: revoke session")
+	err = rps.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `update sessions set revoked_at=now()
+			where id=$1 and revoked_at is null`, sessionID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `update refresh_tokens set revoked_at=now()
+			where family_id=$1 and revoked_at is null`, sessionID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("repository: can't revoke session - %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions method revokes all sessions and refresh tokens of the user
+func (rps PostgresRepository) RevokeUserSessions(ctx context.Context, userUUID string) (err error) {
+	ctx, span := startSpan(ctx, "sessions.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("postgres repository: revoke user sessions")
+	err = rps.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `update sessions set revoked_at=now()
+			where useruuid=$1 and revoked_at is null`, userUUID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `update refresh_tokens set revoked_at=now()
+			where useruuid=$1 and revoked_at is null`, userUUID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("repository: can't revoke user sessions - %w", err)
+	}
+	return nil
+}
+
+// RevokeOtherSessions method revokes all sessions and refresh tokens of the user except the kept
+// session and returns ids of revoked sessions
+func (rps PostgresRepository) RevokeOtherSessions(ctx context.Context, userUUID, keepSessionID string) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "sessions.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID":    userUUID,
+		"sessionID": keepSessionID,
+	}).Debugf("postgres repository: revoke other user sessions")
+	var sessionIDs []string
+	err = rps.inTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `update sessions set revoked_at=now()
+			where useruuid=$1 and id<>$2 and revoked_at is null
+			returning id::text`, userUUID, keepSessionID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			sessionIDs = append(sessionIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `update refresh_tokens set revoked_at=now()
+			where useruuid=$1 and family_id<>$2 and revoked_at is null`, userUUID, keepSessionID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("repository: can't revoke other user sessions - %w", err)
+	}
+	return sessionIDs, nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// SetTOTPSecret method stores totp secret of pending enrollment, secret of enabled second factor isn't replaced
+func (rps PostgresRepository) SetTOTPSecret(ctx context.Context, userUUID, secret string) (err error) {
+	ctx, span := startSpan(ctx, "authusers.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("postgres repository: set authUser totp secret")
+	tag, err := rps.DBconn.Exec(ctx, `update authusers
+		set totp_secret=$2
+		where useruuid=$1 and totp_enabled_at is null`, userUUID, secret)
+	if err != nil {
+		return fmt.Errorf("repository: can't set totp secret - %w", err)
+	}
+	if tag.RowsAffected() != 1 {
+		return fmt.Errorf("repository: can't set totp secret - second factor is already enabled")
+	}
+	return nil
+}
+
+// EnableTOTP method enables second factor of the user and replaces recovery codes,
+// step is time step of the code which confirmed enrollment
+func (rps PostgresRepository) EnableTOTP(ctx context.Context, userUUID string, step int64, recoveryCodeHashes []string) (err error) {
+	ctx, span := startSpan(ctx, "authusers.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("postgres repository: enable authUser totp")
+	err = rps.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `update authusers
+			set totp_enabled_at=now(), totp_last_step=$2
+			where useruuid=$1 and totp_enabled_at is null and totp_secret <> ''`, userUUID, step)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() != 1 {
+			return fmt.Errorf("second factor is already enabled or not enrolled")
+		}
+		if _, err := tx.Exec(ctx, `delete from recovery_codes where useruuid=$1`, userUUID); err != nil {
+			return err
+		}
+		for _, codeHash := range recoveryCodeHashes {
+			if _, err := tx.Exec(ctx, `insert into recovery_codes (useruuid, code_hash)
+				values ($1, $2)`, userUUID, codeHash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("repository: can't enable totp - %w", err)
+	}
+	return nil
+}
+
+// UseTOTPStep method remembers time step of accepted code, it returns false when code
+// of the same or later step was already accepted
+func (rps PostgresRepository) UseTOTPStep(ctx context.Context, userUUID string, step int64) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "authusers.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	tag, err := rps.DBconn.Exec(ctx, `update authusers
+		set totp_last_step=$2
+		where useruuid=$1 and totp_last_step < $2`, userUUID, step)
+	if err != nil {
+		return false, fmt.Errorf("repository: can't use totp step - %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode method marks recovery code of the user as used, it returns false
+// when there is no such unused code
+func (rps PostgresRepository) UseRecoveryCode(ctx context.Context, userUUID, codeHash string) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "recovery_codes.update")
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("postgres repository: use recovery code")
+	tag, err := rps.DBconn.Exec(ctx, `update recovery_codes
+		set used_at=now()
+		where useruuid=$1 and code_hash=$2 and used_at is null`, userUUID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("repository: can't use recovery code - %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan start client span for postgres query, operation should be in form "table.action"
+func startSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "postgres "+operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationKey.String(operation)))
+}
@@ -0,0 +1,208 @@
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/auth"
+	"github.com/EgorBessonov/gRPC/internal/broker"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/metrics"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/repository"
+	log "github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"sync"
+	"time"
+)
+
+const consumerRetryDelay = time.Second
+
+// entry keeps time before which matching tokens were issued and time when it can be forgotten
+type entry struct {
+	issuedBefore time.Time
+	expiresAt    time.Time
+}
+
+// List keeps revoked access tokens in memory to check them on every request, revocations
+// are stored in repository and broadcast to other service replicas through rabbitmq
+type List struct {
+	rps       repository.Repository
+	rabbitCli *broker.RabbitClient
+	// rabbitConn opens dedicated channel of revocations consumer
+	rabbitConn *amqp.Connection
+	mutex      sync.RWMutex
+	tokens     map[string]entry
+	sessions   map[string]entry
+	users      map[string]entry
+}
+
+// New return new empty List instance
+func New(rps repository.Repository, rabbitConn *amqp.Connection, rabbitCli *broker.RabbitClient) *List {
+	return &List{
+		rps:        rps,
+		rabbitCli:  rabbitCli,
+		rabbitConn: rabbitConn,
+		tokens:     make(map[string]entry),
+		sessions:   make(map[string]entry),
+		users:      make(map[string]entry),
+	}
+}
+
+// Load read revocations which are not expired from repository
+func (l *List) Load(ctx context.Context) error {
+	revocations, err := l.rps.GetRevocations(ctx)
+	if err != nil {
+		return fmt.Errorf("revocation: can't load revocations - %w", err)
+	}
+	for i := range revocations {
+		l.apply(&revocations[i])
+	}
+	return nil
+}
+
+// Revoke store revocation, apply it to this replica and send it to other ones. Revocation takes
+// effect once it's stored, so broadcast failure is only logged, other replicas pick the revocation
+// up from repository when their consumers restart
+func (l *List) Revoke(ctx context.Context, revocation *model.Revocation) error {
+	if err := l.rps.SaveRevocation(ctx, revocation); err != nil {
+		return fmt.Errorf("revocation: can't save revocation - %w", err)
+	}
+	l.apply(revocation)
+	if err := l.rabbitCli.PublishRevocation(ctx, revocation); err != nil {
+		logging.FromContext(ctx).Errorf("revocation: can't broadcast revocation - %v", err)
+	}
+	return nil
+}
+
+// IsRevoked checks whether access token of principal was revoked, principals
+// which are not identified by access token are never revoked
+func (l *List) IsRevoked(principal *auth.Principal) bool {
+	if principal.AuthMethod != auth.AuthMethodJWT {
+		return false
+	}
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return matches(l.tokens, principal.TokenID, principal.IssuedAt) ||
+		matches(l.sessions, principal.SessionID, principal.IssuedAt) ||
+		matches(l.users, principal.UserID, principal.IssuedAt)
+}
+
+// Run receive revocations made by other replicas until ctx is cancelled, consumer is subscribed again
+// on own channel when the channel is closed. Repository is read again after consumer is restarted
+// to pick up revocations sent while it was down
+func (l *List) Run(ctx context.Context) {
+	restarted := false
+	for {
+		channel, msgs, err := l.subscribe()
+		if err != nil {
+			log.Errorf("revocation consumer: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(consumerRetryDelay):
+				restarted = true
+				continue
+			}
+		}
+		if restarted {
+			if err := l.Load(ctx); err != nil {
+				log.Errorf("revocation consumer: %v", err)
+			}
+		}
+		stopped := !l.handleDeliveries(ctx, channel, msgs)
+		if err := channel.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
+			log.Errorf("revocation consumer: error while closing channel - %v", err)
+		}
+		if stopped {
+			return
+		}
+		log.Warn("revocation consumer: channel was closed, subscribing again")
+		restarted = true
+	}
+}
+
+// subscribe open dedicated channel and start consuming revocations on it
+func (l *List) subscribe() (*amqp.Channel, <-chan amqp.Delivery, error) {
+	channel, err := l.rabbitConn.Channel()
+	if err != nil {
+		return nil, nil, fmt.Errorf("revocation: can't open channel - %w", err)
+	}
+	msgs, err := l.rabbitCli.ConsumeRevocations(channel)
+	if err != nil {
+		_ = channel.Close()
+		return nil, nil, err
+	}
+	return channel, msgs, nil
+}
+
+// handleDeliveries apply received revocations, it returns false when consumer was stopped by ctx
+// and true when deliveries channel was closed by broker
+func (l *List) handleDeliveries(ctx context.Context, channel *amqp.Channel, msgs <-chan amqp.Delivery) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			if err := channel.Cancel(broker.RevocationConsumerTag, false); err != nil {
+				log.Errorf("revocation consumer: error while cancelling consumer - %v", err)
+			}
+			return false
+		case d, ok := <-msgs:
+			if !ok {
+				return true
+			}
+			revocation := model.Revocation{}
+			if err := json.Unmarshal(d.Body, &revocation); err != nil {
+				metrics.ConsumerErrors.WithLabelValues("rabbitmq").Inc()
+				log.Errorf("revocation consumer: error while parsing message - %v", err)
+				continue
+			}
+			l.apply(&revocation)
+		}
+	}
+}
+
+// apply add revocation to the list and drop entries which are expired
+func (l *List) apply(revocation *model.Revocation) {
+	now := time.Now()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, entries := range []map[string]entry{l.tokens, l.sessions, l.users} {
+		for id, e := range entries {
+			if now.After(e.expiresAt) {
+				delete(entries, id)
+			}
+		}
+	}
+	if now.After(revocation.ExpiresAt) {
+		return
+	}
+	add(l.tokens, revocation.TokenID, revocation)
+	add(l.sessions, revocation.SessionID, revocation)
+	add(l.users, revocation.UserUUID, revocation)
+}
+
+// add merge revocation with existing entry of id, so the latest revocation wins
+func add(entries map[string]entry, id string, revocation *model.Revocation) {
+	if id == "" {
+		return
+	}
+	e := entries[id]
+	if revocation.IssuedBefore.After(e.issuedBefore) {
+		e.issuedBefore = revocation.IssuedBefore
+	}
+	if revocation.ExpiresAt.After(e.expiresAt) {
+		e.expiresAt = revocation.ExpiresAt
+	}
+	entries[id] = e
+}
+
+// matches checks whether token issued at issuedAt is revoked by entry of id, issue time has
+// microseconds precision, so tokens issued right after revocation stay valid
+func matches(entries map[string]entry, id string, issuedAt time.Time) bool {
+	if id == "" {
+		return false
+	}
+	e, ok := entries[id]
+	return ok && issuedAt.Before(e.issuedBefore)
+}
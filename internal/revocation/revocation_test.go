@@ -0,0 +1,75 @@
+package revocation
+
+import (
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"testing"
+	"time"
+)
+
+func TestMatches(t *testing.T) {
+	revokedAt := time.Unix(1600000000, 0)
+	entries := map[string]entry{
+		"token": {issuedBefore: revokedAt, expiresAt: revokedAt.Add(time.Hour)},
+	}
+	tests := []struct {
+		name     string
+		id       string
+		issuedAt time.Time
+		want     bool
+	}{
+		{name: "empty id", id: "", issuedAt: revokedAt.Add(-time.Minute), want: false},
+		{name: "missing entry", id: "other", issuedAt: revokedAt.Add(-time.Minute), want: false},
+		{name: "issued before revocation", id: "token", issuedAt: revokedAt.Add(-time.Microsecond), want: true},
+		{name: "issued at revocation", id: "token", issuedAt: revokedAt, want: false},
+		{name: "issued after revocation", id: "token", issuedAt: revokedAt.Add(time.Microsecond), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matches(entries, tt.id, tt.issuedAt); got != tt.want {
+				t.Errorf("matches(%q, %s) = %v, want %v", tt.id, tt.issuedAt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	base := time.Unix(1600000000, 0)
+	tests := []struct {
+		name        string
+		id          string
+		revocations []*model.Revocation
+		want        map[string]entry
+	}{
+		{
+			name:        "empty id is ignored",
+			id:          "",
+			revocations: []*model.Revocation{{IssuedBefore: base, ExpiresAt: base.Add(time.Hour)}},
+			want:        map[string]entry{},
+		},
+		{
+			name: "latest revocation wins",
+			id:   "user",
+			revocations: []*model.Revocation{
+				{IssuedBefore: base.Add(time.Minute), ExpiresAt: base.Add(time.Hour)},
+				{IssuedBefore: base, ExpiresAt: base.Add(2 * time.Hour)},
+			},
+			want: map[string]entry{"user": {issuedBefore: base.Add(time.Minute), expiresAt: base.Add(2 * time.Hour)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := make(map[string]entry)
+			for _, revocation := range tt.revocations {
+				add(entries, tt.id, revocation)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("add() kept %d entries, want %d", len(entries), len(tt.want))
+			}
+			for id, want := range tt.want {
+				if got := entries[id]; !got.issuedBefore.Equal(want.issuedBefore) || !got.expiresAt.Equal(want.expiresAt) {
+					t.Errorf("entry %s = %+v, want %+v", id, got, want)
+				}
+			}
+		})
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
 	"github.com/EgorBessonov/gRPC/internal/model"
 	ordercrud "github.com/EgorBessonov/gRPC/internal/protocol"
+	"github.com/EgorBessonov/gRPC/internal/repository"
 	"github.com/EgorBessonov/gRPC/internal/service"
-	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
 )
 
 type Server struct {
@@ -33,7 +37,7 @@ func (s Server) SaveOrder(ctx context.Context, request *ordercrud.SaveOrderReque
 	}
 	orderID, err := s.s.Save(ctx, &order)
 	if err != nil {
-		log.Error(fmt.Errorf("handler: can't save order - %e", err))
+		logging.FromContext(ctx).Error(fmt.Errorf("handler: can't save order - %v", err))
 		return nil, err
 	}
 	return &ordercrud.SaveOrderResponse{OrderId: orderID}, nil
@@ -47,7 +51,7 @@ func (s Server) GetOrder(ctx context.Context, request *ordercrud.GetOrderRequest
 	}*/
 	order, err := s.s.Get(ctx, request.OrderId)
 	if err != nil {
-		log.Error(fmt.Errorf("handler: can't get order - %e", err))
+		logging.FromContext(ctx).Error(fmt.Errorf("handler: can't get order - %v", err))
 		return nil, err
 	}
 	return &ordercrud.GetOrderResponse{
@@ -68,7 +72,7 @@ func (s Server) DeleteOrder(ctx context.Context, request *ordercrud.DeleteOrderR
 	}*/
 	err := s.s.Delete(ctx, request.OrderId)
 	if err != nil {
-		log.Error(fmt.Errorf("handler: can't get order - %e", err))
+		logging.FromContext(ctx).Error(fmt.Errorf("handler: can't get order - %v", err))
 		return nil, err
 	}
 	return &ordercrud.DeleteOrderResponse{Result: fmt.Sprint("success")}, nil
@@ -88,7 +92,7 @@ func (s Server) UpdateOrder(ctx context.Context, request *ordercrud.UpdateOrderR
 	}
 	err := s.s.Update(ctx, &order)
 	if err != nil {
-		log.Errorf("handler: can't update order - %e", err)
+		logging.FromContext(ctx).Errorf("handler: can't update order - %v", err)
 		return nil, err
 	}
 	return &ordercrud.UpdateOrderResponse{Result: fmt.Sprint("success")}, nil
@@ -96,14 +100,16 @@ func (s Server) UpdateOrder(ctx context.Context, request *ordercrud.UpdateOrderR
 
 // Authentication method checks user password and if it ok return access and refresh tokens
 func (s Server) Authentication(ctx context.Context, request *ordercrud.AuthenticationRequest) (*ordercrud.AuthenticationResponse, error) {
-	accessToken, refreshToken, err := s.s.Authentication(ctx, request.Email, request.Password)
+	result, err := s.s.Authentication(ctx, request.Email, request.Password)
 	if err != nil {
-		log.Errorf("handler: authentication failed - %e", err)
+		logging.FromContext(ctx).Errorf("handler: authentication failed - %v", err)
 		return nil, err
 	}
 	return &ordercrud.AuthenticationResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken}, nil
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		MfaRequired:  result.ChallengeToken != "",
+		MfaToken:     result.ChallengeToken}, nil
 }
 
 // Registration - method for user creation
@@ -116,8 +122,8 @@ func (s Server) Registration(ctx context.Context, request *ordercrud.Registratio
 	}
 	err := s.s.Registration(ctx, &authUser)
 	if err != nil {
-		log.Errorf("handler: registration failed - %e", err)
-		return nil, err
+		logging.FromContext(ctx).Errorf("handler: registration failed - %v", err)
+		return nil, alreadyExistsStatus(err)
 	}
 	return &ordercrud.RegistrationResponse{Result: fmt.Sprint("success")}, nil
 }
@@ -126,28 +132,341 @@ func (s Server) Registration(ctx context.Context, request *ordercrud.Registratio
 func (s Server) RefreshToken(ctx context.Context, request *ordercrud.RefreshTokenRequest) (*ordercrud.RefreshTokenResponse, error) {
 	rToken := request.RefreshToken
 	if rToken == "" {
-		log.Error("handler: token refresh failed - empty value")
+		logging.FromContext(ctx).Error("handler: token refresh failed - empty value")
 		return nil, errors.New("empty refreshToken value")
 	}
 	accessToken, refreshToken, err := s.s.RefreshToken(ctx, rToken)
 	if err != nil {
-		log.Errorf("handler: token refresh failed - %e", err)
+		logging.FromContext(ctx).Errorf("handler: token refresh failed - %v", err)
 		return nil, err
 	}
 	return &ordercrud.RefreshTokenResponse{RefreshToken: refreshToken, AccessToken: accessToken}, nil
 }
 
-// Logout method delete user refresh token from repository
+// Logout method revokes session of the caller
 func (s Server) Logout(ctx context.Context, request *ordercrud.LogoutRequest) (*ordercrud.LogoutResponse, error) {
-	email := request.Email
-	if email == "" {
-		log.Error("handler: logout failed - empty value")
+	err := s.s.Logout(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: logout failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.LogoutResponse{Result: fmt.Sprint("success")}, nil
+}
+
+// ListSessions method returns active sessions of the caller
+func (s Server) ListSessions(ctx context.Context, request *ordercrud.ListSessionsRequest) (*ordercrud.ListSessionsResponse, error) {
+	sessions, currentSessionID, err := s.s.ListSessions(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: can't list sessions - %v", err)
+		return nil, err
+	}
+	response := &ordercrud.ListSessionsResponse{Sessions: make([]*ordercrud.Session, 0, len(sessions))}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, &ordercrud.Session{
+			SessionId:   session.ID,
+			Device:      session.Device,
+			PeerAddress: session.PeerAddr,
+			CreatedAt:   session.CreatedAt.Unix(),
+			LastUsedAt:  session.LastUsedAt.Unix(),
+			Current:     session.ID == currentSessionID,
+		})
+	}
+	return response, nil
+}
+
+// RevokeSession method revokes one of the caller sessions
+func (s Server) RevokeSession(ctx context.Context, request *ordercrud.RevokeSessionRequest) (*ordercrud.RevokeSessionResponse, error) {
+	if request.SessionId == "" {
+		logging.FromContext(ctx).Error("handler: session revocation failed - empty value")
+		return nil, errors.New("empty sessionID value")
+	}
+	err := s.s.RevokeSession(ctx, request.SessionId)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: session revocation failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.RevokeSessionResponse{Result: fmt.Sprint("success")}, nil
+}
+
+// LogoutAll method revokes all sessions of the caller
+func (s Server) LogoutAll(ctx context.Context, request *ordercrud.LogoutAllRequest) (*ordercrud.LogoutAllResponse, error) {
+	err := s.s.LogoutAll(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: logout failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.LogoutAllResponse{Result: fmt.Sprint("success")}, nil
+}
+
+// GetProfile method returns account of the caller
+func (s Server) GetProfile(ctx context.Context, request *ordercrud.GetProfileRequest) (*ordercrud.GetProfileResponse, error) {
+	authUser, err := s.s.GetProfile(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: can't get profile - %v", err)
+		return nil, err
+	}
+	return &ordercrud.GetProfileResponse{
+		UserUuid:      authUser.UserUUID,
+		UserName:      authUser.UserName,
+		Email:         authUser.Email,
+		EmailVerified: authUser.EmailVerifiedAt != nil,
+		Roles:         authUser.Roles,
+		MfaEnabled:    authUser.TOTPEnabledAt != nil,
+	}, nil
+}
+
+// UpdateProfile method changes user name and email of the caller
+func (s Server) UpdateProfile(ctx context.Context, request *ordercrud.UpdateProfileRequest) (*ordercrud.UpdateProfileResponse, error) {
+	if request.UserName == "" && request.Email == "" {
+		logging.FromContext(ctx).Error("handler: profile update failed - empty value")
+		return nil, errors.New("empty userName and email values")
+	}
+	err := s.s.UpdateProfile(ctx, request.UserName, request.Email, request.Password, request.ReauthToken)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: profile update failed - %v", err)
+		return nil, alreadyExistsStatus(err)
+	}
+	return &ordercrud.UpdateProfileResponse{Result: fmt.Sprint("success")}, nil
+}
+
+// ChangePassword method replaces password of the caller and revokes other sessions
+func (s Server) ChangePassword(ctx context.Context, request *ordercrud.ChangePasswordRequest) (*ordercrud.ChangePasswordResponse, error) {
+	if (request.CurrentPassword == "" && request.ReauthToken == "") || request.NewPassword == "" {
+		logging.FromContext(ctx).Error("handler: password change failed - empty value")
+		return nil, errors.New("empty password value")
+	}
+	err := s.s.ChangePassword(ctx, request.CurrentPassword, request.NewPassword, request.ReauthToken)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: password change failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.ChangePasswordResponse{Result: fmt.Sprint("success")}, nil
+}
+
+// DeleteAccount method erases personal data of the caller
+func (s Server) DeleteAccount(ctx context.Context, request *ordercrud.DeleteAccountRequest) (*ordercrud.DeleteAccountResponse, error) {
+	if request.Password == "" && request.ReauthToken == "" {
+		logging.FromContext(ctx).Error("handler: account deletion failed - empty value")
+		return nil, errors.New("empty password or reauthToken value")
+	}
+	err := s.s.DeleteAccount(ctx, request.Password, request.ReauthToken)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: account deletion failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.DeleteAccountResponse{Result: fmt.Sprint("success")}, nil
+}
+
+// RevokeTokens method revokes access tokens of the user or single token, it's available to administrators
+func (s Server) RevokeTokens(ctx context.Context, request *ordercrud.RevokeTokensRequest) (*ordercrud.RevokeTokensResponse, error) {
+	err := s.s.RevokeTokens(ctx, request.UserUuid, request.TokenId)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: token revocation failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.RevokeTokensResponse{Result: fmt.Sprint("success")}, nil
+}
+
+// VerifyEmail method confirms user email with token sent on registration
+func (s Server) VerifyEmail(ctx context.Context, request *ordercrud.VerifyEmailRequest) (*ordercrud.VerifyEmailResponse, error) {
+	if request.Token == "" {
+		logging.FromContext(ctx).Error("handler: email verification failed - empty value")
+		return nil, errors.New("empty token value")
+	}
+	err := s.s.VerifyEmail(ctx, request.Token)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: email verification failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.VerifyEmailResponse{Result: fmt.Sprint("success")}, nil
+}
+
+// RequestPasswordReset method sends password reset token to the user email
+func (s Server) RequestPasswordReset(ctx context.Context, request *ordercrud.RequestPasswordResetRequest) (*ordercrud.RequestPasswordResetResponse, error) {
+	if request.Email == "" {
+		logging.FromContext(ctx).Error("handler: password reset request failed - empty value")
 		return nil, errors.New("empty email value")
 	}
-	err := s.s.UpdateAuthUser(ctx, email, "")
+	err := s.s.RequestPasswordReset(ctx, request.Email)
 	if err != nil {
-		log.Errorf("handler: logout failed - %e", err)
+		logging.FromContext(ctx).Errorf("handler: password reset request failed - %v", err)
 		return nil, err
 	}
-	return &ordercrud.LogoutResponse{Result: fmt.Sprint("success")}, nil
+	return &ordercrud.RequestPasswordResetResponse{Result: fmt.Sprint("success")}, nil
+}
+
+// ResetPassword method sets new user password with token sent by RequestPasswordReset
+func (s Server) ResetPassword(ctx context.Context, request *ordercrud.ResetPasswordRequest) (*ordercrud.ResetPasswordResponse, error) {
+	if request.Token == "" {
+		logging.FromContext(ctx).Error("handler: password reset failed - empty value")
+		return nil, errors.New("empty token value")
+	}
+	err := s.s.ResetPassword(ctx, request.Token, request.NewPassword)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: password reset failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.ResetPasswordResponse{Result: fmt.Sprint("success")}, nil
+}
+
+// UnlockAccount method allows logins to the account locked out after failed attempts, it's available to administrators
+func (s Server) UnlockAccount(ctx context.Context, request *ordercrud.UnlockAccountRequest) (*ordercrud.UnlockAccountResponse, error) {
+	err := s.s.UnlockAccount(ctx, request.UserUuid)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: account unlock failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.UnlockAccountResponse{Result: fmt.Sprint("success")}, nil
+}
+
+// VerifyMFA method completes login of account with second factor
+func (s Server) VerifyMFA(ctx context.Context, request *ordercrud.VerifyMFARequest) (*ordercrud.VerifyMFAResponse, error) {
+	if request.MfaToken == "" || request.Code == "" {
+		logging.FromContext(ctx).Error("handler: mfa verification failed - empty value")
+		return nil, errors.New("empty mfaToken or code value")
+	}
+	result, err := s.s.VerifyMFA(ctx, request.MfaToken, request.Code)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: mfa verification failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.VerifyMFAResponse{AccessToken: result.AccessToken, RefreshToken: result.RefreshToken}, nil
+}
+
+// OIDCLogin method completes login with external identity provider
+func (s Server) OIDCLogin(ctx context.Context, request *ordercrud.OIDCLoginRequest) (*ordercrud.OIDCLoginResponse, error) {
+	if request.Code == "" || request.CodeVerifier == "" {
+		logging.FromContext(ctx).Error("handler: oidc login failed - empty value")
+		return nil, errors.New("empty code or codeVerifier value")
+	}
+	result, err := s.s.OIDCLogin(ctx, request.Code, request.CodeVerifier, request.Nonce)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: oidc login failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.OIDCLoginResponse{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		MfaRequired:  result.ChallengeToken != "",
+		MfaToken:     result.ChallengeToken,
+		LinkPending:  result.LinkPending}, nil
+}
+
+// ConfirmIdentityLink method links external identity to existing account with the same email
+func (s Server) ConfirmIdentityLink(ctx context.Context, request *ordercrud.ConfirmIdentityLinkRequest) (*ordercrud.ConfirmIdentityLinkResponse, error) {
+	if request.Token == "" {
+		logging.FromContext(ctx).Error("handler: identity link confirmation failed - empty value")
+		return nil, errors.New("empty token value")
+	}
+	err := s.s.ConfirmIdentityLink(ctx, request.Token)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: identity link confirmation failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.ConfirmIdentityLinkResponse{Result: fmt.Sprint("success")}, nil
+}
+
+// OIDCReauthenticate method returns token which confirms sensitive changes of account without password
+func (s Server) OIDCReauthenticate(ctx context.Context, request *ordercrud.OIDCReauthenticateRequest) (*ordercrud.OIDCReauthenticateResponse, error) {
+	if request.Code == "" || request.CodeVerifier == "" {
+		logging.FromContext(ctx).Error("handler: oidc reauthentication failed - empty value")
+		return nil, errors.New("empty code or codeVerifier value")
+	}
+	token, err := s.s.OIDCReauthenticate(ctx, request.Code, request.CodeVerifier, request.Nonce)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: oidc reauthentication failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.OIDCReauthenticateResponse{ReauthToken: token}, nil
+}
+
+// EnrollTOTP method generates totp secret for the caller
+func (s Server) EnrollTOTP(ctx context.Context, request *ordercrud.EnrollTOTPRequest) (*ordercrud.EnrollTOTPResponse, error) {
+	enrollment, err := s.s.EnrollTOTP(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: totp enrollment failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.EnrollTOTPResponse{Secret: enrollment.Secret, Uri: enrollment.URI}, nil
+}
+
+// ConfirmTOTP method enables second factor of the caller and returns recovery codes
+func (s Server) ConfirmTOTP(ctx context.Context, request *ordercrud.ConfirmTOTPRequest) (*ordercrud.ConfirmTOTPResponse, error) {
+	if request.Code == "" {
+		logging.FromContext(ctx).Error("handler: totp confirmation failed - empty value")
+		return nil, errors.New("empty code value")
+	}
+	recoveryCodes, err := s.s.ConfirmTOTP(ctx, request.Code)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: totp confirmation failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.ConfirmTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+// CreateAPIKey method issues api key of the caller
+func (s Server) CreateAPIKey(ctx context.Context, request *ordercrud.CreateAPIKeyRequest) (*ordercrud.CreateAPIKeyResponse, error) {
+	if request.TtlSeconds < 0 {
+		logging.FromContext(ctx).Error("handler: api key creation failed - negative ttl")
+		return nil, errors.New("negative ttlSeconds value")
+	}
+	key, apiKey, err := s.s.CreateAPIKey(ctx, request.Name, request.Scopes, time.Duration(request.TtlSeconds)*time.Second)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: api key creation failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.CreateAPIKeyResponse{Key: key, ApiKey: apiKeyMessage(apiKey)}, nil
+}
+
+// ListAPIKeys method returns api keys of the caller
+func (s Server) ListAPIKeys(ctx context.Context, request *ordercrud.ListAPIKeysRequest) (*ordercrud.ListAPIKeysResponse, error) {
+	keys, err := s.s.ListAPIKeys(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: can't list api keys - %v", err)
+		return nil, err
+	}
+	response := &ordercrud.ListAPIKeysResponse{ApiKeys: make([]*ordercrud.APIKey, 0, len(keys))}
+	for i := range keys {
+		response.ApiKeys = append(response.ApiKeys, apiKeyMessage(&keys[i]))
+	}
+	return response, nil
+}
+
+// RevokeAPIKey method revokes one of the caller api keys
+func (s Server) RevokeAPIKey(ctx context.Context, request *ordercrud.RevokeAPIKeyRequest) (*ordercrud.RevokeAPIKeyResponse, error) {
+	if request.KeyId == "" {
+		logging.FromContext(ctx).Error("handler: api key revocation failed - empty value")
+		return nil, errors.New("empty keyID value")
+	}
+	err := s.s.RevokeAPIKey(ctx, request.KeyId)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("handler: api key revocation failed - %v", err)
+		return nil, err
+	}
+	return &ordercrud.RevokeAPIKeyResponse{Result: fmt.Sprint("success")}, nil
+}
+
+func apiKeyMessage(apiKey *model.APIKey) *ordercrud.APIKey {
+	message := &ordercrud.APIKey{
+		KeyId:     apiKey.ID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scopes:    apiKey.Scopes,
+		CreatedAt: apiKey.CreatedAt.Unix(),
+	}
+	if apiKey.LastUsedAt != nil {
+		message.LastUsedAt = apiKey.LastUsedAt.Unix()
+	}
+	if apiKey.ExpiresAt != nil {
+		message.ExpiresAt = apiKey.ExpiresAt.Unix()
+	}
+	return message
+}
+
+// alreadyExistsStatus converts error about taken email into AlreadyExists status, other errors are returned as is
+func alreadyExistsStatus(err error) error {
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		return status.Error(codes.AlreadyExists, "user with this email already exists")
+	}
+	return err
 }
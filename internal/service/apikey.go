@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/audit"
+	"github.com/EgorBessonov/gRPC/internal/auth"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+const (
+	// apiKeyPrefix tells api keys from other secrets, e.g. in secret scanners
+	apiKeyPrefix      = "ock_"
+	apiKeyPrefixBytes = 4
+	apiKeySecretBytes = 32
+	maxAPIKeyName     = 128
+)
+
+// CreateAPIKey method issues api key of the caller limited to scopes, ttl of zero means the key
+// doesn't expire. Key is returned only once, just its hash is stored
+func (s *Service) CreateAPIKey(ctx context.Context, name string, scopes []string, ttl time.Duration) (string, *model.APIKey, error) {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("service: can't create api key - %w", err)
+	}
+	if len(name) > maxAPIKeyName {
+		return "", nil, fmt.Errorf("service: api key name is longer than %d", maxAPIKeyName)
+	}
+	scopes, err = validScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	prefix, err := randomHex(apiKeyPrefixBytes)
+	if err != nil {
+		return "", nil, fmt.Errorf("service: can't create api key - %w", err)
+	}
+	secret, err := randomHex(apiKeySecretBytes)
+	if err != nil {
+		return "", nil, fmt.Errorf("service: can't create api key - %w", err)
+	}
+	key := apiKeyPrefix + prefix + "_" + secret
+	apiKey := &model.APIKey{
+		ID:        uuid.New().String(),
+		UserUUID:  principal.UserID,
+		Name:      name,
+		Prefix:    apiKeyPrefix + prefix,
+		KeyHash:   hashToken(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		expiresAt := apiKey.CreatedAt.Add(ttl)
+		apiKey.ExpiresAt = &expiresAt
+	}
+	if err := s.rps.SaveAPIKey(ctx, apiKey); err != nil {
+		return "", nil, fmt.Errorf("service: can't create api key - %w", err)
+	}
+	s.opts.Audit.Record(ctx, &audit.Event{
+		Type:     audit.EventAPIKeyCreated,
+		UserUUID: principal.UserID,
+		Email:    principal.Email,
+		PeerAddr: peerHost(ctx),
+		Reason:   "key " + apiKey.Prefix,
+	})
+	return key, apiKey, nil
+}
+
+// ListAPIKeys method returns api keys of the caller which are not revoked
+func (s *Service) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: can't list api keys - %w", err)
+	}
+	keys, err := s.rps.GetUserAPIKeys(ctx, principal.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("service: can't list api keys - %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey method revokes one of the caller api keys, it stops working immediately
+func (s *Service) RevokeAPIKey(ctx context.Context, keyID string) error {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return fmt.Errorf("service: can't revoke api key - %w", err)
+	}
+	revoked, err := s.rps.RevokeAPIKey(ctx, keyID, principal.UserID)
+	if err != nil {
+		return fmt.Errorf("service: can't revoke api key - %w", err)
+	}
+	if !revoked {
+		return fmt.Errorf("service: api key %s not found", keyID)
+	}
+	s.opts.Audit.Record(ctx, &audit.Event{
+		Type:     audit.EventAPIKeyRevoked,
+		UserUUID: principal.UserID,
+		Email:    principal.Email,
+		PeerAddr: peerHost(ctx),
+		Reason:   "key " + keyID,
+	})
+	return nil
+}
+
+// ValidateAPIKey checks api key presented by service client and returns principal of key owner
+// limited to key scopes
+func (s *Service) ValidateAPIKey(ctx context.Context, key string) (*auth.Principal, error) {
+	parts := strings.SplitN(strings.TrimPrefix(key, apiKeyPrefix), "_", 2)
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(parts) != 2 {
+		return nil, fmt.Errorf("service: malformed api key")
+	}
+	apiKey, err := s.rps.GetAPIKeyByPrefix(ctx, apiKeyPrefix+parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(key)), []byte(apiKey.KeyHash)) != 1 {
+		return nil, fmt.Errorf("service: invalid api key %s", apiKey.Prefix)
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, fmt.Errorf("service: api key %s was revoked", apiKey.Prefix)
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, fmt.Errorf("service: api key %s is expired", apiKey.Prefix)
+	}
+	if err := s.rps.TouchAPIKey(ctx, apiKey.ID); err != nil {
+		logging.FromContext(ctx).Errorf("service: can't update api key usage time - %v", err)
+	}
+	return &auth.Principal{
+		Subject:    apiKey.UserUUID,
+		UserID:     apiKey.UserUUID,
+		Scopes:     apiKey.Scopes,
+		TokenID:    apiKey.ID,
+		AuthMethod: auth.AuthMethodAPIKey,
+	}, nil
+}
+
+// validScopes checks that scopes are known and drops duplicates
+func validScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("service: at least one scope is required")
+	}
+	result := make([]string, 0, len(scopes))
+	seen := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		known := false
+		for _, userScope := range auth.UserScopes {
+			known = known || scope == userScope
+		}
+		if !known {
+			return nil, fmt.Errorf("service: unknown scope %q", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/audit"
+	"github.com/EgorBessonov/gRPC/internal/auth"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/ratelimit"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"math"
+	"strconv"
+	"time"
+)
+
+// UnlockAccount method allows logins to the account locked out after failed attempts,
+// it's intended for administrators
+func (s *Service) UnlockAccount(ctx context.Context, userUUID string) error {
+	if userUUID == "" {
+		return fmt.Errorf("service: user id is required")
+	}
+	if err := s.rps.UnlockAuthUser(ctx, userUUID); err != nil {
+		return fmt.Errorf("service: can't unlock account - %w", err)
+	}
+	event := &audit.Event{Type: audit.EventAccountUnlocked, UserUUID: userUUID, PeerAddr: peerHost(ctx)}
+	if principal, ok := auth.FromContext(ctx); ok {
+		event.Actor = principal.Subject
+	}
+	s.opts.Audit.Record(ctx, event)
+	return nil
+}
+
+// loginSucceeded reset failed logins counter of the account and record successful login
+func (s *Service) loginSucceeded(ctx context.Context, event *audit.Event, authUser *model.AuthUser) {
+	if authUser.FailedLogins > 0 {
+		if err := s.rps.UnlockAuthUser(ctx, authUser.UserUUID); err != nil {
+			logging.FromContext(ctx).Errorf("service: can't reset failed logins - %v", err)
+		}
+	}
+	event.Type = audit.EventLoginSucceeded
+	s.opts.Audit.Record(ctx, event)
+}
+
+// loginFailed record failed login and block next logins from the source address and to the account,
+// authUser is nil when account doesn't exist
+func (s *Service) loginFailed(ctx context.Context, event *audit.Event, authUser *model.AuthUser) {
+	event.Type = audit.EventLoginFailed
+	s.opts.Audit.Record(ctx, event)
+	if _, lockedOut := s.opts.LoginAttempts.Fail(event.PeerAddr); lockedOut {
+		logging.FromContext(ctx).WithField("peerAddr", event.PeerAddr).Warn("service: source address is locked out after failed logins")
+	}
+	if authUser == nil {
+		return
+	}
+	failures, err := s.rps.RecordLoginFailure(ctx, authUser.UserUUID, s.opts.AccountLockout.Lockout)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("service: can't record failed login - %v", err)
+		return
+	}
+	until := time.Now().Add(s.opts.AccountLockout.Delay(failures))
+	if err := s.rps.LockAuthUser(ctx, authUser.UserUUID, until); err != nil {
+		logging.FromContext(ctx).Errorf("service: can't block account logins - %v", err)
+		return
+	}
+	if s.opts.AccountLockout.LockedOut(failures) {
+		logging.FromContext(ctx).WithFields(log.Fields{
+			"userID": authUser.UserUUID,
+			"until":  until,
+		}).Warn("service: account is locked out after failed logins")
+		s.opts.Audit.Record(ctx, &audit.Event{
+			Type:     audit.EventAccountLocked,
+			UserUUID: authUser.UserUUID,
+			Email:    event.Email,
+			PeerAddr: event.PeerAddr,
+			Reason:   fmt.Sprintf("%d failed logins", failures),
+		})
+	}
+}
+
+// loginBlocked record login rejected because of previous failures
+func (s *Service) loginBlocked(ctx context.Context, event *audit.Event, reason string) {
+	event.Type, event.Reason = audit.EventLoginBlocked, reason
+	s.opts.Audit.Record(ctx, event)
+}
+
+// blockedError tells the caller when login can be retried, delay is also sent in retry-after header
+// like rate limit errors do
+func blockedError(ctx context.Context, wait time.Duration) error {
+	seconds := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+	if err := grpc.SetHeader(ctx, metadata.Pairs(ratelimit.RetryAfterKey, seconds)); err != nil {
+		logging.FromContext(ctx).Warnf("service: can't set retry-after header - %v", err)
+	}
+	return status.Errorf(codes.ResourceExhausted, "too many failed logins, retry after %ss", seconds)
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/audit"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+	"strings"
+	"time"
+)
+
+const (
+	// tokenTypeMFAChallenge marks one-time tokens which allow to complete login with second factor
+	tokenTypeMFAChallenge = "mfa_challenge"
+
+	// totpPeriod and totpSkew match defaults of authenticator apps, codes of adjacent
+	// periods are accepted to tolerate clock drift
+	totpPeriod = 30
+	totpSkew   = 1
+
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 5
+)
+
+// LoginResult struct holds issued token pair, or challenge token when login
+// must be completed with second factor. LinkPending is set when external identity
+// has to be linked to existing account by confirmation sent to account email
+type LoginResult struct {
+	AccessToken    string
+	RefreshToken   string
+	ChallengeToken string
+	LinkPending    bool
+}
+
+// TOTPEnrollment struct holds secret of pending enrollment and otpauth uri for authenticator apps
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// EnrollTOTP method generates totp secret for the caller, second factor is enabled only after
+// the first code is confirmed with ConfirmTOTP
+func (s *Service) EnrollTOTP(ctx context.Context) (*TOTPEnrollment, error) {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: totp enrollment failed - %w", err)
+	}
+	authUser, err := s.rps.GetAuthUserByID(ctx, principal.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("service: totp enrollment failed - %w", err)
+	}
+	if authUser.TOTPEnabledAt != nil {
+		return nil, fmt.Errorf("service: second factor is already enabled")
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.opts.TOTPIssuer,
+		AccountName: authUser.Email,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service: can't generate totp secret - %w", err)
+	}
+	if err := s.rps.SetTOTPSecret(ctx, authUser.UserUUID, key.Secret()); err != nil {
+		return nil, fmt.Errorf("service: totp enrollment failed - %w", err)
+	}
+	return &TOTPEnrollment{Secret: key.Secret(), URI: key.URL()}, nil
+}
+
+// ConfirmTOTP method checks the first code of enrolled secret and enables second factor,
+// recovery codes are returned only once and can't be read later
+func (s *Service) ConfirmTOTP(ctx context.Context, code string) ([]string, error) {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: totp confirmation failed - %w", err)
+	}
+	authUser, err := s.rps.GetAuthUserByID(ctx, principal.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("service: totp confirmation failed - %w", err)
+	}
+	if authUser.TOTPEnabledAt != nil {
+		return nil, fmt.Errorf("service: second factor is already enabled")
+	}
+	if authUser.TOTPSecret == "" {
+		return nil, fmt.Errorf("service: totp is not enrolled")
+	}
+	step, ok := validateTOTP(authUser.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("service: invalid totp code")
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("service: totp confirmation failed - %w", err)
+	}
+	if err := s.rps.EnableTOTP(ctx, authUser.UserUUID, step, hashes); err != nil {
+		return nil, fmt.Errorf("service: totp confirmation failed - %w", err)
+	}
+	s.opts.Audit.Record(ctx, &audit.Event{
+		Type:     audit.EventMFAEnabled,
+		UserUUID: authUser.UserUUID,
+		Email:    authUser.Email,
+		PeerAddr: peerHost(ctx),
+	})
+	return codes, nil
+}
+
+// VerifyMFA method completes login started by Authentication, code is either totp code
+// or one of recovery codes. Challenge is used by the first attempt, so after wrong code
+// login has to be started again. Wrong codes are counted as failed logins
+func (s *Service) VerifyMFA(ctx context.Context, challengeToken, code string) (*LoginResult, error) {
+	event := &audit.Event{PeerAddr: peerHost(ctx)}
+	if wait := s.opts.LoginAttempts.Blocked(event.PeerAddr); wait > 0 {
+		s.loginBlocked(ctx, event, "source address is locked out")
+		return nil, blockedError(ctx, wait)
+	}
+	authUser, err := s.useOneTimeToken(ctx, challengeToken, tokenTypeMFAChallenge)
+	if err != nil {
+		return nil, fmt.Errorf("service: mfa verification failed - %w", err)
+	}
+	event.UserUUID, event.Email = authUser.UserUUID, authUser.Email
+	if authUser.LockedUntil != nil {
+		if wait := time.Until(*authUser.LockedUntil); wait > 0 {
+			s.loginBlocked(ctx, event, "account is locked out")
+			return nil, blockedError(ctx, wait)
+		}
+	}
+	if authUser.TOTPEnabledAt == nil {
+		return nil, fmt.Errorf("service: second factor is not enabled")
+	}
+	ok, err := s.checkSecondFactor(ctx, authUser, code)
+	if err != nil {
+		return nil, fmt.Errorf("service: mfa verification failed - %w", err)
+	}
+	if !ok {
+		event.Reason = "invalid second factor"
+		s.loginFailed(ctx, event, authUser)
+		return nil, fmt.Errorf("service: invalid second factor code")
+	}
+	s.loginSucceeded(ctx, event, authUser)
+	return s.login(ctx, authUser)
+}
+
+// login issue token pair of new session
+func (s *Service) login(ctx context.Context, authUser *model.AuthUser) (*LoginResult, error) {
+	accessToken, refreshToken, err := s.createTokenPair(ctx, authUser, "")
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// mfaChallenge issue token which allows to complete login with second factor
+func (s *Service) mfaChallenge(ctx context.Context, authUser *model.AuthUser) (*LoginResult, error) {
+	challengeToken, err := s.issueOneTimeToken(ctx, authUser, tokenTypeMFAChallenge, s.opts.MFAChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{ChallengeToken: challengeToken}, nil
+}
+
+// checkSecondFactor checks totp code, code of already used time step is rejected as replayed,
+// codes which are not totp ones are checked as recovery codes
+func (s *Service) checkSecondFactor(ctx context.Context, authUser *model.AuthUser, code string) (bool, error) {
+	if step, ok := validateTOTP(authUser.TOTPSecret, code, time.Now()); ok {
+		return s.rps.UseTOTPStep(ctx, authUser.UserUUID, step)
+	}
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) != hex.EncodedLen(recoveryCodeBytes) {
+		return false, nil
+	}
+	return s.rps.UseRecoveryCode(ctx, authUser.UserUUID, hashToken(normalized))
+}
+
+// validateTOTP checks code against time steps around now and returns matched step
+func validateTOTP(secret, code string, now time.Time) (int64, bool) {
+	opts := hotp.ValidateOpts{Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if ok, err := hotp.ValidateCustom(code, uint64(step), secret, opts); err == nil && ok {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// newRecoveryCodes return random recovery codes formatted for reading and their hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("service: can't generate recovery code - %w", err)
+		}
+		code := hex.EncodeToString(b)
+		codes = append(codes, code[:len(code)/2]+"-"+code[len(code)/2:])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode drop separators and case which don't matter for recovery code
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
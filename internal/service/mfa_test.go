@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"testing"
+	"time"
+)
+
+const testPeer = "192.0.2.1"
+
+// mfaUser holds account with enabled second factor and its secrets
+type mfaUser struct {
+	authUser      *model.AuthUser
+	recoveryCodes []string
+}
+
+// addMFAUser creates account with password "secret" and enabled totp
+func (f *fixture) addMFAUser(t *testing.T) *mfaUser {
+	hash, err := hashPassword("secret")
+	if err != nil {
+		t.Fatalf("hashPassword() error = %v", err)
+	}
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "ordercrud", AccountName: "user@example.com", Period: totpPeriod})
+	if err != nil {
+		t.Fatalf("totp.Generate() error = %v", err)
+	}
+	authUser := f.rps.addUser(&model.AuthUser{Email: "user@example.com", Password: hash, TOTPSecret: key.Secret()})
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatalf("newRecoveryCodes() error = %v", err)
+	}
+	_ = f.rps.EnableTOTP(context.Background(), authUser.UserUUID, 0, hashes)
+	return &mfaUser{authUser: authUser, recoveryCodes: codes}
+}
+
+// challenge starts login of mfa user and return challenge token
+func (f *fixture) challenge(t *testing.T, ctx context.Context) string {
+	result, err := f.service.Authentication(ctx, "user@example.com", "secret")
+	if err != nil {
+		t.Fatalf("Authentication() error = %v", err)
+	}
+	if result.ChallengeToken == "" || result.AccessToken != "" {
+		t.Fatalf("Authentication() = %+v, want mfa challenge without tokens", result)
+	}
+	return result.ChallengeToken
+}
+
+func totpCode(t *testing.T, secret string) string {
+	code, err := totp.GenerateCodeCustom(secret, time.Now(), totp.ValidateOpts{
+		Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1})
+	if err != nil {
+		t.Fatalf("totp.GenerateCodeCustom() error = %v", err)
+	}
+	return code
+}
+
+func peerContext() context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(testPeer), Port: 50000}})
+}
+
+func TestVerifyMFA(t *testing.T) {
+	tests := []struct {
+		name string
+		// code return second factor code, it can change repository state before verification
+		code         func(t *testing.T, f *fixture, user *mfaUser) string
+		wantErr      bool
+		wantFailures int
+	}{
+		{
+			name: "totp code",
+			code: func(t *testing.T, _ *fixture, user *mfaUser) string {
+				return totpCode(t, user.authUser.TOTPSecret)
+			},
+		},
+		{
+			name: "recovery code",
+			code: func(_ *testing.T, _ *fixture, user *mfaUser) string {
+				return user.recoveryCodes[0]
+			},
+		},
+		{
+			name: "replayed totp code",
+			code: func(t *testing.T, f *fixture, user *mfaUser) string {
+				f.rps.totpSteps[user.authUser.UserUUID] = time.Now().Unix()/totpPeriod + totpSkew
+				return totpCode(t, user.authUser.TOTPSecret)
+			},
+			wantErr:      true,
+			wantFailures: 1,
+		},
+		{
+			name: "wrong code",
+			code: func(_ *testing.T, _ *fixture, _ *mfaUser) string {
+				return "000000-not-a-code"
+			},
+			wantErr:      true,
+			wantFailures: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			user := f.addMFAUser(t)
+			ctx := peerContext()
+			challenge := f.challenge(t, ctx)
+			result, err := f.service.VerifyMFA(ctx, challenge, tt.code(t, f, user))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyMFA() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (result.AccessToken == "" || result.RefreshToken == "") {
+				t.Errorf("VerifyMFA() = %+v, want token pair", result)
+			}
+			authUser, _ := f.rps.GetAuthUserByID(ctx, user.authUser.UserUUID)
+			if authUser.FailedLogins != tt.wantFailures {
+				t.Errorf("failed logins = %d, want %d", authUser.FailedLogins, tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestVerifyMFAChallengeIsUsedFirst(t *testing.T) {
+	tests := []struct {
+		name string
+		// spend makes challenge unusable
+		spend func(t *testing.T, f *fixture, challenge string)
+	}{
+		{
+			name: "used challenge",
+			spend: func(t *testing.T, f *fixture, challenge string) {
+				if _, err := f.service.VerifyMFA(peerContext(), challenge, "wrong"); err == nil {
+					t.Fatal("VerifyMFA() with wrong code error = nil, want error")
+				}
+			},
+		},
+		{
+			name: "expired challenge",
+			spend: func(_ *testing.T, f *fixture, _ string) {
+				for _, token := range f.rps.tokens {
+					token.ExpiresAt = time.Now().Add(-time.Second)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			user := f.addMFAUser(t)
+			challenge := f.challenge(t, peerContext())
+			tt.spend(t, f, challenge)
+			before, _ := f.rps.GetAuthUserByID(context.Background(), user.authUser.UserUUID)
+			if _, err := f.service.VerifyMFA(peerContext(), challenge, user.recoveryCodes[0]); err == nil {
+				t.Fatal("VerifyMFA() error = nil, want error")
+			}
+			if !f.rps.recoveryCodes[user.authUser.UserUUID][hashToken(normalizeRecoveryCode(user.recoveryCodes[0]))] {
+				t.Error("recovery code is used with unusable challenge")
+			}
+			after, _ := f.rps.GetAuthUserByID(context.Background(), user.authUser.UserUUID)
+			if after.FailedLogins != before.FailedLogins {
+				t.Errorf("failed logins = %d, want %d", after.FailedLogins, before.FailedLogins)
+			}
+		})
+	}
+}
+
+func TestVerifyMFABlockedPeer(t *testing.T) {
+	f := newFixture(t)
+	user := f.addMFAUser(t)
+	ctx := peerContext()
+	challenge := f.challenge(t, ctx)
+	for i := 0; i < f.service.opts.AccountLockout.Threshold; i++ {
+		f.service.opts.LoginAttempts.Fail(testPeer)
+	}
+	_, err := f.service.VerifyMFA(ctx, challenge, user.recoveryCodes[0])
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("VerifyMFA() error = %v, want code %s", err, codes.ResourceExhausted)
+	}
+	if len(f.rps.recoveryCodes[user.authUser.UserUUID]) != recoveryCodeCount {
+		t.Error("recovery code is used by blocked peer")
+	}
+}
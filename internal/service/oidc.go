@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/audit"
+	"github.com/EgorBessonov/gRPC/internal/idp"
+	"github.com/EgorBessonov/gRPC/internal/mail"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/repository"
+	"time"
+)
+
+const (
+	// tokenTypeIdentityLink marks one-time tokens which confirm linking external identity to existing account
+	tokenTypeIdentityLink = "identity_link"
+	// tokenTypeReauth marks one-time tokens which confirm sensitive changes of accounts without password
+	tokenTypeReauth = "reauth"
+)
+
+// errLinkPending is returned when identity can be linked to existing account only after confirmation
+var errLinkPending = errors.New("service: identity link is waiting for confirmation")
+
+// OIDCLogin method completes authorization code flow with PKCE started by the client at external identity
+// provider and returns our token pair. Users are matched by provider subject, on the first login new account
+// is created, or, when account with the same email exists, linking has to be confirmed with token sent to
+// the email and no tokens are issued. Lockouts and second factor of the account apply the same way as to
+// password logins
+func (s *Service) OIDCLogin(ctx context.Context, code, codeVerifier, nonce string) (*LoginResult, error) {
+	if s.opts.IdentityProvider == nil {
+		return nil, fmt.Errorf("service: oidc login is not configured")
+	}
+	event := &audit.Event{PeerAddr: peerHost(ctx)}
+	if wait := s.opts.LoginAttempts.Blocked(event.PeerAddr); wait > 0 {
+		s.loginBlocked(ctx, event, "source address is locked out")
+		return nil, blockedError(ctx, wait)
+	}
+	identity, err := s.opts.IdentityProvider.Exchange(ctx, code, codeVerifier, nonce)
+	if err != nil {
+		event.Reason = "oidc exchange failed"
+		s.loginFailed(ctx, event, nil)
+		return nil, fmt.Errorf("service: oidc login failed - %w", err)
+	}
+	authUser, err := s.externalUser(ctx, identity)
+	if errors.Is(err, errLinkPending) {
+		return &LoginResult{LinkPending: true}, nil
+	}
+	if err != nil {
+		event.Type, event.Reason, event.Email = audit.EventLoginFailed, "oidc account lookup failed", identity.Email
+		s.opts.Audit.Record(ctx, event)
+		return nil, fmt.Errorf("service: oidc login failed - %w", err)
+	}
+	event.UserUUID, event.Email, event.Reason = authUser.UserUUID, authUser.Email, "oidc"
+	if authUser.LockedUntil != nil {
+		if wait := time.Until(*authUser.LockedUntil); wait > 0 {
+			s.loginBlocked(ctx, event, "account is locked out")
+			return nil, blockedError(ctx, wait)
+		}
+	}
+	return s.completeLogin(ctx, event, authUser)
+}
+
+// ConfirmIdentityLink method links external identity named by token to account which the token
+// was sent to, the user signs in with the provider again after that
+func (s *Service) ConfirmIdentityLink(ctx context.Context, token string) error {
+	authUser, claims, err := s.useOneTimeTokenClaims(ctx, token, tokenTypeIdentityLink)
+	if err != nil {
+		return fmt.Errorf("service: identity link confirmation failed - %w", err)
+	}
+	if err := s.rps.LinkIdentity(ctx, claims.IdentityIssuer, claims.IdentitySubject, authUser.UserUUID); err != nil {
+		return fmt.Errorf("service: identity link confirmation failed - %w", err)
+	}
+	s.opts.Audit.Record(ctx, &audit.Event{Type: audit.EventIdentityLinked, UserUUID: authUser.UserUUID,
+		Email: authUser.Email, PeerAddr: peerHost(ctx), Reason: claims.IdentityIssuer})
+	return nil
+}
+
+// externalUser return user linked to identity, new account is linked on the first login. Account with
+// the same email is linked only after confirmation, errLinkPending is returned until that. Email is
+// trusted only when the provider confirmed it, since it is used to find existing account
+func (s *Service) externalUser(ctx context.Context, identity *idp.Identity) (*model.AuthUser, error) {
+	authUser, err := s.rps.GetAuthUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return authUser, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	email := normalizeEmail(identity.Email)
+	if email == "" || !identity.EmailVerified {
+		return nil, fmt.Errorf("service: identity provider didn't confirm user email")
+	}
+	authUser, err = s.rps.GetAuthUser(ctx, email)
+	if err == nil {
+		return nil, s.requestIdentityLink(ctx, authUser, identity)
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	authUser = &model.AuthUser{UserName: identity.Name, Email: email}
+	err = s.rps.CreateExternalAuthUser(ctx, authUser, identity.Issuer, identity.Subject)
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		// concurrent login with the same identity or registration with the same email took the email first
+		return s.existingUser(ctx, identity, email)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.opts.Audit.Record(ctx, &audit.Event{Type: audit.EventIdentityLinked, UserUUID: authUser.UserUUID,
+		Email: authUser.Email, PeerAddr: peerHost(ctx), Reason: identity.Issuer})
+	return authUser, nil
+}
+
+// existingUser return user created while external account was being created, it's linked to identity
+// when it was created by login with the same identity, otherwise linking has to be confirmed
+func (s *Service) existingUser(ctx context.Context, identity *idp.Identity, email string) (*model.AuthUser, error) {
+	authUser, err := s.rps.GetAuthUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	if !errors.Is(err, repository.ErrNotFound) {
+		return authUser, err
+	}
+	authUser, err = s.rps.GetAuthUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.requestIdentityLink(ctx, authUser, identity)
+}
+
+// requestIdentityLink sends confirmation of linking identity to the account and returns errLinkPending
+func (s *Service) requestIdentityLink(ctx context.Context, authUser *model.AuthUser, identity *idp.Identity) error {
+	if err := s.sendIdentityLink(ctx, authUser, identity); err != nil {
+		return err
+	}
+	return errLinkPending
+}
+
+// OIDCReauthenticate method checks that the caller has just signed in with identity provider again and
+// returns token which confirms sensitive changes of account without password instead of it. Provider
+// must report auth_time, e.g. when client sends max_age=0 in authorization request
+func (s *Service) OIDCReauthenticate(ctx context.Context, code, codeVerifier, nonce string) (string, error) {
+	if s.opts.IdentityProvider == nil {
+		return "", fmt.Errorf("service: oidc login is not configured")
+	}
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return "", fmt.Errorf("service: oidc reauthentication failed - %w", err)
+	}
+	identity, err := s.opts.IdentityProvider.Exchange(ctx, code, codeVerifier, nonce)
+	if err != nil {
+		return "", fmt.Errorf("service: oidc reauthentication failed - %w", err)
+	}
+	if identity.AuthTime.IsZero() || time.Since(identity.AuthTime) > s.opts.ReauthTTL {
+		return "", fmt.Errorf("service: identity provider didn't authenticate the user again")
+	}
+	authUser, err := s.rps.GetAuthUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != nil {
+		return "", fmt.Errorf("service: oidc reauthentication failed - %w", err)
+	}
+	if authUser.UserUUID != principal.UserID {
+		return "", fmt.Errorf("service: identity is linked to another account")
+	}
+	token, err := s.issueOneTimeToken(ctx, authUser, tokenTypeReauth, s.opts.ReauthTTL)
+	if err != nil {
+		return "", fmt.Errorf("service: oidc reauthentication failed - %w", err)
+	}
+	return token, nil
+}
+
+// sendIdentityLink issues token which confirms linking identity to existing account and sends it
+// to the account email, so only owner of the account can link it
+func (s *Service) sendIdentityLink(ctx context.Context, authUser *model.AuthUser, identity *idp.Identity) error {
+	token, err := s.issueOneTimeTokenWithClaims(ctx, authUser, &CustomClaims{
+		Type:            tokenTypeIdentityLink,
+		IdentityIssuer:  identity.Issuer,
+		IdentitySubject: identity.Subject,
+	}, s.opts.IdentityLinkTTL)
+	if err != nil {
+		return err
+	}
+	return s.opts.Mailer.Send(ctx, &mail.Message{
+		To:      authUser.Email,
+		Subject: "Confirm sign in with external account",
+		Body: fmt.Sprintf("Hello %s,\n\nsomeone signed in with %s account which has your email. Use the following token "+
+			"to link that account to yours, it is valid for %s:\n\n%s\n\nIgnore this message if it wasn't you.\n",
+			authUser.UserName, identity.Issuer, s.opts.IdentityLinkTTL, token),
+	})
+}
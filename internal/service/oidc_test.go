@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/auth"
+	"github.com/EgorBessonov/gRPC/internal/idp/idptest"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+// login signs in with identity provider user with claims
+func (f *fixture) login(claims map[string]interface{}) (*LoginResult, error) {
+	claims["nonce"] = testNonce
+	code := f.idp.Authorize(testClientID, idptest.CodeChallenge(testVerifier), claims)
+	return f.service.OIDCLogin(context.Background(), code, testVerifier, testNonce)
+}
+
+func TestOIDCLoginCreatesAccount(t *testing.T) {
+	f := newFixture(t)
+	result, err := f.login(map[string]interface{}{"sub": "user-1", "email": "User@Example.com ", "email_verified": true, "name": "User"})
+	if err != nil {
+		t.Fatalf("OIDCLogin() error = %v", err)
+	}
+	if result.AccessToken == "" || result.RefreshToken == "" {
+		t.Fatalf("OIDCLogin() = %+v, want token pair", result)
+	}
+	userUUID := f.rps.linked(f.idp.URL, "user-1")
+	if userUUID == "" {
+		t.Fatal("identity isn't linked")
+	}
+	authUser, _ := f.rps.GetAuthUserByID(context.Background(), userUUID)
+	if authUser.Email != "user@example.com" || authUser.Password != "" || authUser.EmailVerifiedAt == nil {
+		t.Errorf("created user = %+v", authUser)
+	}
+	// the next login finds the same account
+	if _, err := f.login(map[string]interface{}{"sub": "user-1", "email": "user@example.com", "email_verified": true}); err != nil {
+		t.Fatalf("second OIDCLogin() error = %v", err)
+	}
+	if len(f.rps.users) != 1 {
+		t.Errorf("users = %d, want 1", len(f.rps.users))
+	}
+}
+
+func TestOIDCLoginRejectsUnverifiedEmail(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+	}{
+		{name: "unverified email", claims: map[string]interface{}{"sub": "user-1", "email": "user@example.com"}},
+		{name: "no email", claims: map[string]interface{}{"sub": "user-1", "email_verified": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.rps.addUser(&model.AuthUser{Email: "user@example.com", Password: "hash"})
+			if _, err := f.login(tt.claims); err == nil {
+				t.Fatal("OIDCLogin() error = nil, want error")
+			}
+			if f.rps.linked(f.idp.URL, "user-1") != "" || len(f.mailer.messages) != 0 {
+				t.Error("identity was linked or link was requested")
+			}
+		})
+	}
+}
+
+func TestOIDCLoginRejectsBadNonce(t *testing.T) {
+	f := newFixture(t)
+	code := f.idp.Authorize(testClientID, idptest.CodeChallenge(testVerifier),
+		map[string]interface{}{"sub": "user-1", "email": "user@example.com", "email_verified": true, "nonce": "other"})
+	if _, err := f.service.OIDCLogin(context.Background(), code, testVerifier, testNonce); err == nil {
+		t.Fatal("OIDCLogin() error = nil, want error")
+	}
+	if len(f.rps.users) != 0 {
+		t.Error("account was created")
+	}
+}
+
+func TestOIDCLoginLinksExistingAccountAfterConfirmation(t *testing.T) {
+	f := newFixture(t)
+	existing := f.rps.addUser(&model.AuthUser{Email: "user@example.com", Password: "hash"})
+	claims := func() map[string]interface{} {
+		return map[string]interface{}{"sub": "user-1", "email": "user@example.com", "email_verified": true}
+	}
+	result, err := f.login(claims())
+	if err != nil {
+		t.Fatalf("OIDCLogin() error = %v", err)
+	}
+	if !result.LinkPending || result.AccessToken != "" {
+		t.Fatalf("OIDCLogin() = %+v, want pending link without tokens", result)
+	}
+	if f.rps.linked(f.idp.URL, "user-1") != "" {
+		t.Fatal("identity is linked before confirmation")
+	}
+	if to := f.mailer.messages[0].To; to != existing.Email {
+		t.Errorf("confirmation is sent to %q, want %q", to, existing.Email)
+	}
+	token := f.mailer.lastToken(t)
+	if err := f.service.ConfirmIdentityLink(context.Background(), token); err != nil {
+		t.Fatalf("ConfirmIdentityLink() error = %v", err)
+	}
+	if got := f.rps.linked(f.idp.URL, "user-1"); got != existing.UserUUID {
+		t.Fatalf("identity is linked to %q, want %q", got, existing.UserUUID)
+	}
+	if err := f.service.ConfirmIdentityLink(context.Background(), token); err == nil {
+		t.Error("second ConfirmIdentityLink() error = nil, want error")
+	}
+	result, err = f.login(claims())
+	if err != nil {
+		t.Fatalf("OIDCLogin() after confirmation error = %v", err)
+	}
+	if result.AccessToken == "" {
+		t.Errorf("OIDCLogin() after confirmation = %+v, want token pair", result)
+	}
+}
+
+func TestOIDCLoginAppliesAccountChecks(t *testing.T) {
+	lockedUntil := time.Now().Add(time.Hour)
+	enabledAt := time.Now()
+	tests := []struct {
+		name     string
+		user     *model.AuthUser
+		wantCode codes.Code
+		wantMFA  bool
+	}{
+		{name: "locked account", user: &model.AuthUser{Email: "user@example.com", LockedUntil: &lockedUntil}, wantCode: codes.ResourceExhausted},
+		{name: "second factor", user: &model.AuthUser{Email: "user@example.com", TOTPEnabledAt: &enabledAt}, wantMFA: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			authUser := f.rps.addUser(tt.user)
+			_ = f.rps.LinkIdentity(context.Background(), f.idp.URL, "user-1", authUser.UserUUID)
+			result, err := f.login(map[string]interface{}{"sub": "user-1", "email": "user@example.com", "email_verified": true})
+			if tt.wantCode != codes.OK {
+				if status.Code(err) != tt.wantCode {
+					t.Fatalf("OIDCLogin() error = %v, want code %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OIDCLogin() error = %v", err)
+			}
+			if tt.wantMFA && (result.ChallengeToken == "" || result.AccessToken != "") {
+				t.Errorf("OIDCLogin() = %+v, want mfa challenge without tokens", result)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginConcurrentFirstLogin(t *testing.T) {
+	f := newFixture(t)
+	// concurrent login with the same identity creates account first
+	f.rps.beforeCreate = func() {
+		f.rps.beforeCreate = nil
+		_ = f.rps.CreateExternalAuthUser(context.Background(), &model.AuthUser{Email: "user@example.com"}, f.idp.URL, "user-1")
+	}
+	result, err := f.login(map[string]interface{}{"sub": "user-1", "email": "user@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatalf("OIDCLogin() error = %v", err)
+	}
+	if result.AccessToken == "" {
+		t.Errorf("OIDCLogin() = %+v, want token pair", result)
+	}
+	if len(f.rps.users) != 1 {
+		t.Errorf("users = %d, want 1", len(f.rps.users))
+	}
+}
+
+func TestReauthenticateExternalAccount(t *testing.T) {
+	f := newFixture(t)
+	if _, err := f.login(map[string]interface{}{"sub": "user-1", "email": "user@example.com", "email_verified": true}); err != nil {
+		t.Fatalf("OIDCLogin() error = %v", err)
+	}
+	userUUID := f.rps.linked(f.idp.URL, "user-1")
+	ctx := auth.NewContext(context.Background(), &auth.Principal{UserID: userUUID, SessionID: uuid.New().String()})
+	if err := f.service.ChangePassword(ctx, "", "new password", ""); err == nil {
+		t.Fatal("ChangePassword() without reauthentication error = nil, want error")
+	}
+	reauth := func(authTime time.Time) (string, error) {
+		code := f.idp.Authorize(testClientID, idptest.CodeChallenge(testVerifier),
+			map[string]interface{}{"sub": "user-1", "nonce": testNonce, "auth_time": authTime.Unix()})
+		return f.service.OIDCReauthenticate(ctx, code, testVerifier, testNonce)
+	}
+	if _, err := reauth(time.Now().Add(-time.Hour)); err == nil {
+		t.Fatal("OIDCReauthenticate() with old auth_time error = nil, want error")
+	}
+	token, err := reauth(time.Now())
+	if err != nil {
+		t.Fatalf("OIDCReauthenticate() error = %v", err)
+	}
+	if err := f.service.ChangePassword(ctx, "", "new password", token); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	authUser, _ := f.rps.GetAuthUserByID(ctx, userUUID)
+	if authUser.Password == "" {
+		t.Error("password isn't set")
+	}
+	// account has password now, so it's required instead of reauthentication
+	if err := f.service.ChangePassword(ctx, "", "other password", token); err == nil {
+		t.Error("ChangePassword() without current password error = nil, want error")
+	}
+}
+
+func TestOIDCLoginFailedExchangeBlocksPeer(t *testing.T) {
+	f := newFixture(t)
+	ctx := peerContext()
+	for i := 0; i < f.service.opts.AccountLockout.Threshold; i++ {
+		if _, err := f.service.OIDCLogin(ctx, "unknown-code", testVerifier, testNonce); err == nil {
+			t.Fatal("OIDCLogin() with unknown code error = nil, want error")
+		}
+	}
+	code := f.idp.Authorize(testClientID, idptest.CodeChallenge(testVerifier),
+		map[string]interface{}{"sub": "user-1", "email": "user@example.com", "email_verified": true, "nonce": testNonce})
+	if _, err := f.service.OIDCLogin(ctx, code, testVerifier, testNonce); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("OIDCLogin() error = %v, want code %s", err, codes.ResourceExhausted)
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+// argon2id parameters of current password hash version
+const (
+	argonTime    = 1
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+	argonSaltLen = 16
+
+	argonPrefix = "$argon2id$"
+
+	// dummyPasswordHash is checked when account has no password to compare with, so the
+	// response takes the same time whether the account exists or not
+	dummyPasswordHash = "$argon2id$v=19$m=65536,t=1,p=4$Gr87wYPMOrmWJlXQR6DVEA$IPWM2xYG1AOykHcGYCpvQF2lELDO+JT5JMuxED2oAs0"
+)
+
+// errInvalidCredentials is returned for unknown email and wrong password alike
+var errInvalidCredentials = errors.New("service: invalid email or password")
+
+// hashPassword return password hash encoded as $argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", fmt.Errorf("service: zero password value")
+	}
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("service: can't generate salt - %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argonPrefix, argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyPassword compare password with encoded hash in constant time, needsRehash is true
+// when the hash was made by legacy sha256 scheme or with outdated argon2id parameters
+func verifyPassword(password, encodedHash string) (ok bool, needsRehash bool, err error) {
+	if !strings.HasPrefix(encodedHash, argonPrefix) {
+		return verifyLegacyPassword(password, encodedHash), true, nil
+	}
+	var version int
+	var memory uint32
+	var iterations uint32
+	var threads uint8
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 {
+		return false, false, fmt.Errorf("service: invalid password hash format")
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, fmt.Errorf("service: unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, false, fmt.Errorf("service: invalid argon2 parameters - %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, fmt.Errorf("service: invalid password salt - %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, fmt.Errorf("service: invalid password hash - %w", err)
+	}
+	otherKey := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false, nil
+	}
+	needsRehash = memory != argonMemory || iterations != argonTime || threads != argonThreads || len(key) != argonKeyLen
+	return true, needsRehash, nil
+}
+
+// verifyLegacyPassword checks password against unsalted sha256 hash used before argon2id
+func verifyLegacyPassword(password, encodedHash string) bool {
+	h := sha256.Sum256([]byte(password))
+	legacyHash := base64.URLEncoding.EncodeToString(h[:])
+	return subtle.ConstantTimeCompare([]byte(legacyHash), []byte(encodedHash)) == 1
+}
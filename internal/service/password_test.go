@@ -0,0 +1,71 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"golang.org/x/crypto/argon2"
+	"testing"
+)
+
+func legacyHash(password string) string {
+	h := sha256.Sum256([]byte(password))
+	return base64.URLEncoding.EncodeToString(h[:])
+}
+
+func TestVerifyPassword(t *testing.T) {
+	hash, err := hashPassword("secret")
+	if err != nil {
+		t.Fatalf("hashPassword() error = %v", err)
+	}
+	tests := []struct {
+		name            string
+		password        string
+		encodedHash     string
+		wantOK          bool
+		wantNeedsRehash bool
+		wantErr         bool
+	}{
+		{name: "argon2id round trip", password: "secret", encodedHash: hash, wantOK: true},
+		{name: "argon2id wrong password", password: "other", encodedHash: hash},
+		{name: "outdated argon2id parameters", password: "secret",
+			encodedHash: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$" +
+				base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("secret"), []byte("saltsaltsaltsalt"), 1, 1024, 1, argonKeyLen)),
+			wantOK: true, wantNeedsRehash: true},
+		{name: "dummy hash", password: "secret", encodedHash: dummyPasswordHash},
+		{name: "legacy hash", password: "secret", encodedHash: legacyHash("secret"), wantOK: true, wantNeedsRehash: true},
+		{name: "legacy wrong password", password: "other", encodedHash: legacyHash("secret"), wantNeedsRehash: true},
+		{name: "missing parts", password: "secret", encodedHash: "$argon2id$v=19$m=65536,t=1,p=4$salt", wantErr: true},
+		{name: "unsupported version", password: "secret", encodedHash: "$argon2id$v=16$m=65536,t=1,p=4$c2FsdA$aGFzaA", wantErr: true},
+		{name: "invalid parameters", password: "secret", encodedHash: "$argon2id$v=19$m=x,t=1,p=4$c2FsdA$aGFzaA", wantErr: true},
+		{name: "invalid salt", password: "secret", encodedHash: "$argon2id$v=19$m=65536,t=1,p=4$!!!$aGFzaA", wantErr: true},
+		{name: "invalid hash", password: "secret", encodedHash: "$argon2id$v=19$m=65536,t=1,p=4$c2FsdA$!!!", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := verifyPassword(tt.password, tt.encodedHash)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyPassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOK || needsRehash != tt.wantNeedsRehash {
+				t.Errorf("verifyPassword() = %v, %v, want %v, %v", ok, needsRehash, tt.wantOK, tt.wantNeedsRehash)
+			}
+		})
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	if _, err := hashPassword(""); err == nil {
+		t.Error("hashPassword(\"\") error = nil, want error")
+	}
+	first, err := hashPassword("secret")
+	if err != nil {
+		t.Fatalf("hashPassword() error = %v", err)
+	}
+	second, err := hashPassword("secret")
+	if err != nil {
+		t.Fatalf("hashPassword() error = %v", err)
+	}
+	if first == second {
+		t.Error("hashPassword() returned same hash twice, salt isn't random")
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/audit"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/model"
+)
+
+// GetProfile method returns account of the caller
+func (s *Service) GetProfile(ctx context.Context) (*model.AuthUser, error) {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: can't get profile - %w", err)
+	}
+	authUser, err := s.rps.GetAuthUserByID(ctx, principal.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("service: can't get profile - %w", err)
+	}
+	return authUser, nil
+}
+
+// UpdateProfile method changes user name and email of the caller, empty values are kept. Changing email
+// requires current password or reauthentication token, the new address has to be verified again
+func (s *Service) UpdateProfile(ctx context.Context, userName, email, password, reauthToken string) error {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return fmt.Errorf("service: can't update profile - %w", err)
+	}
+	authUser, err := s.rps.GetAuthUserByID(ctx, principal.UserID)
+	if err != nil {
+		return fmt.Errorf("service: can't update profile - %w", err)
+	}
+	email = normalizeEmail(email)
+	emailChanged := email != "" && email != authUser.Email
+	if emailChanged {
+		if err := s.reauthenticate(ctx, authUser, password, reauthToken); err != nil {
+			return fmt.Errorf("service: can't update profile - %w", err)
+		}
+		authUser.Email = email
+		authUser.EmailVerifiedAt = nil
+	}
+	if userName != "" {
+		authUser.UserName = userName
+	}
+	if err := s.rps.UpdateProfile(ctx, authUser.UserUUID, authUser.UserName, authUser.Email); err != nil {
+		return fmt.Errorf("service: can't update profile - %w", err)
+	}
+	if emailChanged {
+		s.opts.Audit.Record(ctx, &audit.Event{Type: audit.EventEmailChanged, UserUUID: authUser.UserUUID,
+			Email: authUser.Email, PeerAddr: peerHost(ctx)})
+		// profile is already updated, verification can be requested again by changing email
+		if err := s.sendEmailVerification(ctx, authUser); err != nil {
+			logging.FromContext(ctx).Errorf("service: can't send email verification - %v", err)
+		}
+	}
+	return nil
+}
+
+// ChangePassword method replaces password of the caller after checking the current one or reauthentication
+// token of account without password, pending password resets and all sessions of the caller except
+// the current one are revoked
+func (s *Service) ChangePassword(ctx context.Context, currentPassword, newPassword, reauthToken string) error {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return fmt.Errorf("service: can't change password - %w", err)
+	}
+	authUser, err := s.rps.GetAuthUserByID(ctx, principal.UserID)
+	if err != nil {
+		return fmt.Errorf("service: can't change password - %w", err)
+	}
+	if err := s.reauthenticate(ctx, authUser, currentPassword, reauthToken); err != nil {
+		return fmt.Errorf("service: can't change password - %w", err)
+	}
+	hPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("service: can't change password - %w", err)
+	}
+	if err := s.rps.UpdatePassword(ctx, authUser.UserUUID, hPassword); err != nil {
+		return fmt.Errorf("service: can't change password - %w", err)
+	}
+	if err := s.rps.DeleteOneTimeTokens(ctx, authUser.UserUUID, tokenTypePasswordReset); err != nil {
+		return fmt.Errorf("service: can't change password - %w", err)
+	}
+	sessionIDs, err := s.rps.RevokeOtherSessions(ctx, authUser.UserUUID, principal.SessionID)
+	if err != nil {
+		return fmt.Errorf("service: can't change password - %w", err)
+	}
+	for _, sessionID := range sessionIDs {
+		if err := s.revokeAccessTokens(ctx, &model.Revocation{SessionID: sessionID}); err != nil {
+			return fmt.Errorf("service: can't change password - %w", err)
+		}
+	}
+	s.opts.Audit.Record(ctx, &audit.Event{Type: audit.EventPasswordChanged, UserUUID: authUser.UserUUID,
+		Email: authUser.Email, PeerAddr: peerHost(ctx)})
+	return nil
+}
+
+// DeleteAccount method erases personal data of the caller after checking password or reauthentication token,
+// the account can't be used anymore and orders created by the caller are kept without owner
+func (s *Service) DeleteAccount(ctx context.Context, password, reauthToken string) error {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return fmt.Errorf("service: can't delete account - %w", err)
+	}
+	authUser, err := s.rps.GetAuthUserByID(ctx, principal.UserID)
+	if err != nil {
+		return fmt.Errorf("service: can't delete account - %w", err)
+	}
+	if err := s.reauthenticate(ctx, authUser, password, reauthToken); err != nil {
+		return fmt.Errorf("service: can't delete account - %w", err)
+	}
+	if err := s.rps.DeleteAuthUser(ctx, authUser.UserUUID); err != nil {
+		return fmt.Errorf("service: can't delete account - %w", err)
+	}
+	if err := s.revokeAccessTokens(ctx, &model.Revocation{UserUUID: authUser.UserUUID}); err != nil {
+		return fmt.Errorf("service: can't delete account - %w", err)
+	}
+	// email is not recorded, audit trail must not keep personal data of deleted account
+	s.opts.Audit.Record(ctx, &audit.Event{Type: audit.EventAccountDeleted, UserUUID: authUser.UserUUID,
+		PeerAddr: peerHost(ctx)})
+	return nil
+}
+
+// reauthenticate checks that the user confirmed sensitive change, user enters password again, or account
+// without password, which signs in with identity provider, presents token issued by OIDCReauthenticate
+func (s *Service) reauthenticate(ctx context.Context, authUser *model.AuthUser, password, reauthToken string) error {
+	if authUser.Password != "" {
+		return checkCurrentPassword(authUser, password)
+	}
+	if reauthToken == "" {
+		return fmt.Errorf("service: account has no password, reauthentication with identity provider is required")
+	}
+	tokenUser, err := s.useOneTimeToken(ctx, reauthToken, tokenTypeReauth)
+	if err != nil {
+		return err
+	}
+	if tokenUser.UserUUID != authUser.UserUUID {
+		return fmt.Errorf("service: reauthentication token was issued for another user")
+	}
+	return nil
+}
+
+// checkCurrentPassword checks password which user has to enter again to confirm sensitive changes
+func checkCurrentPassword(authUser *model.AuthUser, password string) error {
+	if password == "" {
+		return fmt.Errorf("service: current password is required")
+	}
+	ok, _, err := verifyPassword(password, authUser.Password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("service: invalid password")
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/mail"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"time"
+)
+
+const (
+	// tokenTypePasswordReset marks one-time tokens which allow to set new password
+	tokenTypePasswordReset = "password_reset"
+
+	// passwordResetSendTimeout limits delivery of reset email which outlives the request
+	passwordResetSendTimeout = 30 * time.Second
+	// maxBackgroundSends limits emails which are being sent after request is answered
+	maxBackgroundSends = 64
+)
+
+// RequestPasswordReset method sends password reset token to the user with email. Result doesn't depend
+// on whether user exists and the email is sent in background, so the method can't be used to find accounts
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	logger := logging.FromContext(ctx)
+	authUser, err := s.rps.GetAuthUser(ctx, normalizeEmail(email))
+	if err != nil {
+		logger.Infof("service: password reset requested for unknown email - %v", err)
+		return nil
+	}
+	select {
+	case s.sendSlots <- struct{}{}:
+	default:
+		logger.Warn("service: too many emails are being sent, password reset is dropped")
+		return nil
+	}
+	s.sends.Add(1)
+	sendCtx, cancel := context.WithTimeout(logging.NewContext(context.Background(), logger), passwordResetSendTimeout)
+	go func() {
+		defer func() {
+			cancel()
+			<-s.sendSlots
+			s.sends.Done()
+		}()
+		if err := s.sendPasswordReset(sendCtx, authUser); err != nil {
+			logger.Errorf("service: can't send password reset - %v", err)
+		}
+	}()
+	return nil
+}
+
+// ResetPassword method checks password reset token and replaces user password, other reset tokens,
+// all sessions, access tokens and api keys of the user are revoked after that
+func (s *Service) ResetPassword(ctx context.Context, token, password string) error {
+	if password == "" {
+		return fmt.Errorf("service: zero password value")
+	}
+	authUser, err := s.useOneTimeToken(ctx, token, tokenTypePasswordReset)
+	if err != nil {
+		return fmt.Errorf("service: password reset failed - %w", err)
+	}
+	hPassword, err := hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("service: password reset failed - %w", err)
+	}
+	if err := s.rps.UpdatePassword(ctx, authUser.UserUUID, hPassword); err != nil {
+		return fmt.Errorf("service: password reset failed - %w", err)
+	}
+	if err := s.rps.DeleteOneTimeTokens(ctx, authUser.UserUUID, tokenTypePasswordReset); err != nil {
+		return fmt.Errorf("service: password reset failed - %w", err)
+	}
+	if err := s.revokeUserCredentials(ctx, authUser.UserUUID); err != nil {
+		return fmt.Errorf("service: password reset failed - %w", err)
+	}
+	if err := s.rps.UnlockAuthUser(ctx, authUser.UserUUID); err != nil {
+		logging.FromContext(ctx).Errorf("service: can't unlock account on password reset - %v", err)
+	}
+	// reset token was received by email, so the address is confirmed as well
+	if authUser.EmailVerifiedAt == nil {
+		if err := s.rps.VerifyEmail(ctx, authUser.UserUUID); err != nil {
+			logging.FromContext(ctx).Errorf("service: can't verify email on password reset - %v", err)
+		}
+	}
+	return nil
+}
+
+// sendPasswordReset issues password reset token and sends it to the user
+func (s *Service) sendPasswordReset(ctx context.Context, authUser *model.AuthUser) error {
+	token, err := s.issueOneTimeToken(ctx, authUser, tokenTypePasswordReset, s.opts.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	return s.opts.Mailer.Send(ctx, &mail.Message{
+		To:      authUser.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nuse the following token to set a new password, it is valid for %s:\n\n%s\n\n"+
+			"If you didn't request password reset, ignore this email.\n",
+			authUser.UserName, s.opts.PasswordResetTTL, token),
+	})
+}
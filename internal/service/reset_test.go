@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/auth"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestChangePasswordRevokesPasswordResets(t *testing.T) {
+	f := newFixture(t)
+	hash, _ := hashPassword("secret")
+	authUser := f.rps.addUser(&model.AuthUser{Email: "user@example.com", Password: hash})
+	if err := f.service.RequestPasswordReset(context.Background(), "user@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset() error = %v", err)
+	}
+	if err := f.service.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	token := f.mailer.lastToken(t)
+	ctx := auth.NewContext(context.Background(), &auth.Principal{UserID: authUser.UserUUID, SessionID: uuid.New().String()})
+	if err := f.service.ChangePassword(ctx, "secret", "new secret", ""); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	if err := f.service.ResetPassword(context.Background(), token, "other secret"); err == nil {
+		t.Fatal("ResetPassword() with token issued before password change error = nil, want error")
+	}
+	changed, _ := f.rps.GetAuthUserByID(context.Background(), authUser.UserUUID)
+	if ok, _, _ := verifyPassword("new secret", changed.Password); !ok {
+		t.Error("password was replaced by reset")
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/audit"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// RevokeTokens method revokes single access token by its id or all tokens, sessions and api keys
+// of the user, it's intended for administrators
+func (s *Service) RevokeTokens(ctx context.Context, userUUID, tokenID string) error {
+	if userUUID == "" && tokenID == "" {
+		return fmt.Errorf("service: user id or token id is required")
+	}
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID":  userUUID,
+		"tokenID": tokenID,
+	}).Info("service: access tokens are revoked by administrator")
+	if userUUID != "" {
+		if err := s.revokeUserCredentials(ctx, userUUID); err != nil {
+			return fmt.Errorf("service: can't revoke tokens - %w", err)
+		}
+	}
+	if tokenID != "" {
+		if err := s.revokeAccessTokens(ctx, &model.Revocation{TokenID: tokenID}); err != nil {
+			return fmt.Errorf("service: can't revoke tokens - %w", err)
+		}
+	}
+	return nil
+}
+
+// revokeUser revokes all sessions, refresh and access tokens of the user
+func (s *Service) revokeUser(ctx context.Context, userUUID string) error {
+	if err := s.rps.RevokeUserSessions(ctx, userUUID); err != nil {
+		return err
+	}
+	return s.revokeAccessTokens(ctx, &model.Revocation{UserUUID: userUUID})
+}
+
+// revokeUserCredentials revokes sessions and tokens of the user together with api keys, which
+// are not checked against access token revocations
+func (s *Service) revokeUserCredentials(ctx context.Context, userUUID string) error {
+	if err := s.revokeUser(ctx, userUUID); err != nil {
+		return err
+	}
+	revoked, err := s.rps.RevokeUserAPIKeys(ctx, userUUID)
+	if err != nil {
+		return err
+	}
+	if revoked > 0 {
+		s.opts.Audit.Record(ctx, &audit.Event{
+			Type:     audit.EventAPIKeyRevoked,
+			UserUUID: userUUID,
+			PeerAddr: peerHost(ctx),
+			Reason:   fmt.Sprintf("%d keys of the user", revoked),
+		})
+	}
+	return nil
+}
+
+// revokeAccessTokens revokes access tokens matching revocation which were issued until now,
+// revocation is kept while any of such tokens may be still valid
+func (s *Service) revokeAccessTokens(ctx context.Context, revocation *model.Revocation) error {
+	now := time.Now().Truncate(time.Microsecond)
+	revocation.IssuedBefore = now
+	revocation.ExpiresAt = now.Add(s.opts.AccessTokenTTL)
+	return s.opts.Revocations.Revoke(ctx, revocation)
+}
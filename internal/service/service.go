@@ -3,16 +3,26 @@ package service
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
+	"errors"
 	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/audit"
+	"github.com/EgorBessonov/gRPC/internal/auth"
 	"github.com/EgorBessonov/gRPC/internal/cache"
+	"github.com/EgorBessonov/gRPC/internal/idp"
+	"github.com/EgorBessonov/gRPC/internal/keyset"
+	"github.com/EgorBessonov/gRPC/internal/lockout"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/mail"
 	"github.com/EgorBessonov/gRPC/internal/model"
 	"github.com/EgorBessonov/gRPC/internal/repository"
+	"github.com/EgorBessonov/gRPC/internal/revocation"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc/metadata"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt"
@@ -21,28 +31,111 @@ import (
 // Service type
 type Service struct {
 	rps   repository.Repository
-	cache *cache.OrderCache
+	cache cache.OrderCache
+	opts  Options
+	// orderLoads collapses concurrent repository reads of the same order on cache miss
+	orderLoads singleflight.Group
+	// sends tracks emails sent after request is answered, sendSlots bounds their number
+	sends     sync.WaitGroup
+	sendSlots chan struct{}
+}
+
+// Options struct represents service settings
+type Options struct {
+	// Keys signs issued tokens and verifies presented ones
+	Keys *keyset.KeySet
+	// Revocations revokes access tokens before they expire
+	Revocations *revocation.List
+	// Issuer and Audience are put in issued tokens and required from presented ones
+	Issuer          string
+	Audience        string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Mailer delivers verification emails
+	Mailer mail.Mailer
+	// RequireEmailVerification blocks authentication of users who didn't verify email
+	RequireEmailVerification bool
+	EmailVerificationTTL     time.Duration
+	PasswordResetTTL         time.Duration
+	// AccountLockout blocks logins to account after consecutive failures, LoginAttempts
+	// does the same for source addresses
+	AccountLockout lockout.Policy
+	LoginAttempts  *lockout.Tracker
+	Audit          *audit.Logger
+	// TOTPIssuer names the service in authenticator apps
+	TOTPIssuer      string
+	MFAChallengeTTL time.Duration
+	// IdentityProvider enables login with external OpenID Connect provider, it's nil when not configured
+	IdentityProvider *idp.Provider
+	// IdentityLinkTTL limits time to confirm linking identity to existing account
+	IdentityLinkTTL time.Duration
+	// ReauthTTL limits time after sign in with identity provider during which account
+	// without password can confirm sensitive changes
+	ReauthTTL time.Duration
 }
 
 // NewService method returns new Service instance
-func NewService(_rps repository.Repository, cache *cache.OrderCache) *Service {
-	return &Service{rps: _rps, cache: cache}
+func NewService(_rps repository.Repository, cache cache.OrderCache, opts Options) *Service {
+	return &Service{rps: _rps, cache: cache, opts: opts, sendSlots: make(chan struct{}, maxBackgroundSends)}
+}
+
+// Drain waits until emails sent in background are delivered or ctx is done
+func (s *Service) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.sends.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("service: background emails drain failed - %w", ctx.Err())
+	}
 }
 
 const (
-	accessTokenExTime  = 15
-	refreshTokenExTime = 720
+	authorizationKey = "authorization"
+	bearerScheme     = "bearer"
+	// legacyTokenKey is deprecated metadata key, clients should send authorization: Bearer <token>
+	legacyTokenKey = "accesstoken"
+
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
 )
 
-// CustomClaims struct represent user information in tokens
+// CustomClaims struct represent user information in tokens, subject is user uuid
+// and type tells access tokens from refresh ones. IssuedAtMicro is issue time in unix
+// microseconds, it is compared with revocations, which are made within the same second as logins.
+// IdentityIssuer and IdentitySubject name external identity which identity link token links
 type CustomClaims struct {
-	email    string
-	userName string
+	Email           string   `json:"email,omitempty"`
+	UserName        string   `json:"userName,omitempty"`
+	Roles           []string `json:"roles,omitempty"`
+	Scope           string   `json:"scope,omitempty"`
+	Session         string   `json:"sid,omitempty"`
+	Type            string   `json:"typ"`
+	IssuedAtMicro   int64    `json:"iat_us,omitempty"`
+	IdentityIssuer  string   `json:"idp_iss,omitempty"`
+	IdentitySubject string   `json:"idp_sub,omitempty"`
 	jwt.StandardClaims
 }
 
-// Registration method hash user password and after that save user in repository
+// issuedAt return token issue time, tokens without microseconds claim fall back to iat
+func (c *CustomClaims) issuedAt() time.Time {
+	if c.IssuedAtMicro != 0 {
+		return time.Unix(0, c.IssuedAtMicro*int64(time.Microsecond))
+	}
+	return time.Unix(c.IssuedAt, 0)
+}
+
+// Registration method normalize user email, hash user password and after that save user in repository,
+// repository.ErrAlreadyExists is returned when email is taken
 func (s *Service) Registration(ctx context.Context, authUser *model.AuthUser) error {
+	authUser.Email = normalizeEmail(authUser.Email)
+	if authUser.Email == "" {
+		return fmt.Errorf("service: zero email value")
+	}
 	hPassword, err := hashPassword(authUser.Password)
 	if err != nil {
 		return err
@@ -52,138 +145,314 @@ func (s *Service) Registration(ctx context.Context, authUser *model.AuthUser) er
 	if err != nil {
 		return fmt.Errorf("service: registration failed - %w", err)
 	}
+	// user is already registered, so failed delivery doesn't fail registration
+	if err := s.sendEmailVerification(ctx, authUser); err != nil {
+		logging.FromContext(ctx).Errorf("service: can't send email verification - %v", err)
+	}
 	return nil
 }
 
-// RefreshToken method checks refresh token for validity and if it's ok return new token pair
+// RefreshToken method checks refresh token for validity and if it's ok return new token pair,
+// presented token is rotated and presenting it again revokes the whole token family. Tokens
+// revoked by logout are just rejected, since only rotated tokens can be reused by a thief
 func (s *Service) RefreshToken(ctx context.Context, refreshTokenString string) (string, string, error) {
-	keyFunc := func(t *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("SECRETKEY")), nil
-	}
-	refreshToken, err := jwt.Parse(refreshTokenString, keyFunc)
+	claims, err := s.parseToken(refreshTokenString, tokenTypeRefresh)
 	if err != nil {
 		return "", "", fmt.Errorf("service: can't parse refresh token - %w", err)
 	}
-	if !refreshToken.Valid {
-		return "", "", fmt.Errorf("service: expired refresh token")
+	storedToken, err := s.rps.GetRefreshToken(ctx, claims.Id)
+	if err != nil {
+		return "", "", fmt.Errorf("service: token refresh failed - %w", err)
+	}
+	if storedToken.UserUUID != claims.Subject || storedToken.TokenHash != hashToken(refreshTokenString) {
+		return "", "", fmt.Errorf("service: invalid refresh token")
 	}
-	claims := refreshToken.Claims.(jwt.MapClaims)
-	userUUID := claims["jti"]
-	if userUUID == "" {
-		return "", "", fmt.Errorf("service: error while parsing claims")
+	if err := s.checkRefreshTokenState(ctx, storedToken); err != nil {
+		return "", "", err
 	}
-	authUser, err := s.rps.GetAuthUserByID(ctx, userUUID.(string))
+	used, err := s.rps.UseRefreshToken(ctx, storedToken.ID)
 	if err != nil {
 		return "", "", fmt.Errorf("service: token refresh failed - %w", err)
 	}
-	if refreshTokenString != authUser.RefreshToken {
-		return "", "", fmt.Errorf("service: invalid refresh token")
+	if !used {
+		// token was rotated by concurrent request or revoked by concurrent logout
+		storedToken, err = s.rps.GetRefreshToken(ctx, claims.Id)
+		if err != nil {
+			return "", "", fmt.Errorf("service: token refresh failed - %w", err)
+		}
+		if err := s.checkRefreshTokenState(ctx, storedToken); err != nil {
+			return "", "", err
+		}
+		return "", "", fmt.Errorf("service: token refresh failed - token can't be used")
+	}
+	authUser, err := s.rps.GetAuthUserByID(ctx, storedToken.UserUUID)
+	if err != nil {
+		return "", "", fmt.Errorf("service: token refresh failed - %w", err)
+	}
+	if err := s.rps.TouchSession(ctx, storedToken.FamilyID); err != nil {
+		logging.FromContext(ctx).Errorf("service: can't update session usage time - %v", err)
 	}
-	return createTokenPair(s.rps, ctx, authUser)
+	return s.createTokenPair(ctx, authUser, storedToken.FamilyID)
 }
 
-// Authentication method check user password for validity and if it's correct return access and refresh tokens
-func (s *Service) Authentication(ctx context.Context, email, password string) (string, string, error) {
-	hashPassword, err := hashPassword(password)
-	if err != nil {
-		return "", "", err
+// checkRefreshTokenState rejects refresh token which was rotated or revoked, presenting rotated token
+// means it was stolen, so the whole token family is revoked in that case
+func (s *Service) checkRefreshTokenState(ctx context.Context, token *model.RefreshToken) error {
+	if token.UsedAt != nil {
+		return s.revokeReusedFamily(ctx, token)
+	}
+	if token.RevokedAt != nil {
+		return fmt.Errorf("service: refresh token was revoked")
+	}
+	return nil
+}
+
+// Authentication method check user password for validity and if it's correct return access and refresh tokens,
+// users with second factor get challenge token for VerifyMFA instead. Password hashed by outdated scheme
+// is rehashed after successful check
+func (s *Service) Authentication(ctx context.Context, email, password string) (*LoginResult, error) {
+	if password == "" {
+		return nil, fmt.Errorf("service: zero password value")
+	}
+	email = normalizeEmail(email)
+	event := &audit.Event{Email: email, PeerAddr: peerHost(ctx)}
+	if wait := s.opts.LoginAttempts.Blocked(event.PeerAddr); wait > 0 {
+		s.loginBlocked(ctx, event, "source address is locked out")
+		return nil, blockedError(ctx, wait)
 	}
 	authForm, err := s.rps.GetAuthUser(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		_, _, _ = verifyPassword(password, dummyPasswordHash)
+		event.Reason = "unknown email"
+		s.loginFailed(ctx, event, nil)
+		return nil, errInvalidCredentials
+	}
 	if err != nil {
-		return "", "", fmt.Errorf("service: authentication failed - %w", err)
+		event.Reason = "account lookup failed"
+		s.loginFailed(ctx, event, nil)
+		return nil, fmt.Errorf("service: authentication failed - %w", err)
+	}
+	event.UserUUID = authForm.UserUUID
+	if authForm.LockedUntil != nil {
+		if wait := time.Until(*authForm.LockedUntil); wait > 0 {
+			s.loginBlocked(ctx, event, "account is locked out")
+			return nil, blockedError(ctx, wait)
+		}
+	}
+	if authForm.Password == "" {
+		// account created by identity provider signs in only through it
+		_, _, _ = verifyPassword(password, dummyPasswordHash)
+		event.Reason = "account has no password"
+		s.loginFailed(ctx, event, authForm)
+		return nil, errInvalidCredentials
+	}
+	ok, needsRehash, err := verifyPassword(password, authForm.Password)
+	if err != nil {
+		return nil, fmt.Errorf("service: authentication failed - %w", err)
+	}
+	if !ok {
+		event.Reason = "invalid password"
+		s.loginFailed(ctx, event, authForm)
+		return nil, errInvalidCredentials
+	}
+	if needsRehash {
+		s.rehashPassword(ctx, authForm.UserUUID, password)
+	}
+	if s.opts.RequireEmailVerification && authForm.EmailVerifiedAt == nil {
+		event.Type, event.Reason = audit.EventLoginFailed, "email is not verified"
+		s.opts.Audit.Record(ctx, event)
+		return nil, fmt.Errorf("service: email is not verified")
+	}
+	return s.completeLogin(ctx, event, authForm)
+}
+
+// completeLogin issue token pair of authenticated user, or challenge token when account has second factor
+func (s *Service) completeLogin(ctx context.Context, event *audit.Event, authUser *model.AuthUser) (*LoginResult, error) {
+	if authUser.TOTPEnabledAt != nil {
+		event.Type = audit.EventMFARequired
+		s.opts.Audit.Record(ctx, event)
+		return s.mfaChallenge(ctx, authUser)
 	}
-	if authForm.Password != hashPassword {
-		return "", "", fmt.Errorf("service: invalid password")
+	s.loginSucceeded(ctx, event, authUser)
+	return s.login(ctx, authUser)
+}
+
+// rehashPassword store password hash made by current scheme, failure doesn't break authentication
+func (s *Service) rehashPassword(ctx context.Context, userUUID, password string) {
+	hPassword, err := hashPassword(password)
+	if err == nil {
+		err = s.rps.UpdatePassword(ctx, userUUID, hPassword)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Errorf("service: password rehash failed - %v", err)
+		return
 	}
-	return createTokenPair(s.rps, ctx, authForm)
+	logging.FromContext(ctx).WithField("userID", userUUID).Info("service: password rehashed")
 }
 
-// UpdateAuthUser method update user instance in repository
-func (s *Service) UpdateAuthUser(ctx context.Context, email string, refreshToken string) error {
-	return s.rps.UpdateAuthUser(ctx, email, refreshToken)
+// Logout method revokes session of the caller access token
+func (s *Service) Logout(ctx context.Context) error {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return fmt.Errorf("service: logout failed - %w", err)
+	}
+	if err := s.rps.RevokeSession(ctx, principal.SessionID); err != nil {
+		return fmt.Errorf("service: logout failed - %w", err)
+	}
+	if err := s.revokeAccessTokens(ctx, &model.Revocation{SessionID: principal.SessionID}); err != nil {
+		return fmt.Errorf("service: logout failed - %w", err)
+	}
+	return nil
 }
 
-func ValidateToken(ctx context.Context) (bool, error) {
+// ValidateToken checks access token from request metadata and returns principal built from token claims
+func (s *Service) ValidateToken(ctx context.Context) (*auth.Principal, error) {
 	tokenString, err := getTokenFormContext(ctx)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("SECRETKEY")), nil
-	})
+	claims, err := s.parseToken(tokenString, tokenTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+	return &auth.Principal{
+		Subject:    claims.Subject,
+		UserID:     claims.Subject,
+		Email:      claims.Email,
+		Roles:      claims.Roles,
+		Scopes:     strings.Fields(claims.Scope),
+		SessionID:  claims.Session,
+		TokenID:    claims.Id,
+		IssuedAt:   claims.issuedAt(),
+		AuthMethod: auth.AuthMethodJWT,
+	}, nil
+}
+
+// parseToken verify token signature and expiration, check that it was issued by this service
+// for expected audience and has expected type, so refresh token can't be used as access one
+func (s *Service) parseToken(tokenString, tokenType string) (*CustomClaims, error) {
+	claims := &CustomClaims{}
+	token, err := s.opts.Keys.Parse(tokenString, claims)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	if !token.Valid {
-		return false, fmt.Errorf("invalid or expired token.")
+		return nil, fmt.Errorf("service: invalid or expired token")
+	}
+	if !claims.VerifyIssuer(s.opts.Issuer, true) {
+		return nil, fmt.Errorf("service: unexpected token issuer %q", claims.Issuer)
+	}
+	if !claims.VerifyAudience(s.opts.Audience, true) {
+		return nil, fmt.Errorf("service: unexpected token audience %q", claims.Audience)
+	}
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("service: unexpected token type %q, %s token is required", claims.Type, tokenType)
+	}
+	if claims.Subject == "" || claims.Id == "" {
+		return nil, fmt.Errorf("service: token has no subject or id")
 	}
-	return true, nil
+	return claims, nil
 }
 
-func createTokenPair(rps repository.Repository, ctx context.Context, authUser *model.AuthUser) (string, string, error) {
-	expirationTimeAT := time.Now().Add(accessTokenExTime * time.Minute)
-	expirationTimeRT := time.Now().Add(time.Hour * refreshTokenExTime)
+// createTokenPair issue access and refresh tokens, new session is started when sessionID is empty
+func (s *Service) createTokenPair(ctx context.Context, authUser *model.AuthUser, sessionID string) (string, string, error) {
+	if sessionID == "" {
+		session := &model.Session{
+			ID:       uuid.New().String(),
+			UserUUID: authUser.UserUUID,
+			Device:   deviceFromContext(ctx),
+			PeerAddr: peerFromContext(ctx),
+		}
+		if err := s.rps.CreateSession(ctx, session); err != nil {
+			return "", "", fmt.Errorf("service: can't create session - %w", err)
+		}
+		sessionID = session.ID
+	}
+	// revocations are stored with microseconds precision
+	now := time.Now().Truncate(time.Microsecond)
+	expirationTimeAT := now.Add(s.opts.AccessTokenTTL)
+	expirationTimeRT := now.Add(s.opts.RefreshTokenTTL)
 
 	atClaims := &CustomClaims{
-		userName: authUser.UserName,
-		email:    authUser.Email,
+		UserName:      authUser.UserName,
+		Email:         authUser.Email,
+		Roles:         authUser.Roles,
+		Scope:         strings.Join(auth.UserScopes, " "),
+		Session:       sessionID,
+		Type:          tokenTypeAccess,
+		IssuedAtMicro: now.UnixNano() / int64(time.Microsecond),
 		StandardClaims: jwt.StandardClaims{
+			Subject:   authUser.UserUUID,
+			Issuer:    s.opts.Issuer,
+			Audience:  s.opts.Audience,
+			IssuedAt:  now.Unix(),
 			ExpiresAt: expirationTimeAT.Unix(),
+			Id:        uuid.New().String(),
 		},
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	accessTokenString, err := accessToken.SignedString([]byte(os.Getenv("SECRETKEY")))
+	accessTokenString, err := s.opts.Keys.Sign(atClaims)
 	if err != nil {
 		return "", "", fmt.Errorf("service: can't generate access token - %w", err)
 	}
 
 	rtClaims := &CustomClaims{
-		userName: authUser.UserName,
-		email:    authUser.Email,
+		Session: sessionID,
+		Type:    tokenTypeRefresh,
 		StandardClaims: jwt.StandardClaims{
+			Subject:   authUser.UserUUID,
+			Issuer:    s.opts.Issuer,
+			Audience:  s.opts.Audience,
+			IssuedAt:  now.Unix(),
 			ExpiresAt: expirationTimeRT.Unix(),
-			Id:        authUser.UserUUID,
+			Id:        uuid.New().String(),
 		},
 	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
-	refreshTokenString, err := refreshToken.SignedString([]byte(os.Getenv("SECRETKEY")))
+	refreshTokenString, err := s.opts.Keys.Sign(rtClaims)
 	if err != nil {
 		return "", "", fmt.Errorf("service: can't generate refresh token - %w", err)
 	}
 
-	err = rps.UpdateAuthUser(ctx, authUser.Email, refreshTokenString)
+	err = s.rps.SaveRefreshToken(ctx, &model.RefreshToken{
+		ID:        rtClaims.Id,
+		FamilyID:  sessionID,
+		UserUUID:  authUser.UserUUID,
+		TokenHash: hashToken(refreshTokenString),
+		ExpiresAt: expirationTimeRT,
+	})
 	if err != nil {
 		return "", "", fmt.Errorf("service: can't set refresh token - %w", err)
 	}
 	return accessTokenString, refreshTokenString, nil
 }
 
-func hashPassword(password string) (string, error) {
-	if password == "" {
-		return "", fmt.Errorf("service: zero password value")
-	}
-	h := sha256.New()
-	h.Write([]byte(password))
-	hashedPassword := base64.URLEncoding.EncodeToString(h.Sum(nil))
-	return hashedPassword, nil
-}
-
+// getTokenFormContext return access token from authorization metadata, legacy accessToken
+// key is accepted during deprecation window
 func getTokenFormContext(ctx context.Context) (string, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
 		return "", fmt.Errorf("service: can't get metadata from context")
 	}
-	accessToken, ok := md["accessToken"]
-	if !ok || len(accessToken) == 0 {
-		return "", fmt.Errorf("service: no token in metadata")
+	if authorization := md.Get(authorizationKey); len(authorization) != 0 {
+		parts := strings.SplitN(authorization[0], " ", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], bearerScheme) || strings.TrimSpace(parts[1]) == "" {
+			return "", fmt.Errorf("service: invalid authorization metadata, expected bearer token")
+		}
+		return strings.TrimSpace(parts[1]), nil
+	}
+	if accessToken := md.Get(legacyTokenKey); len(accessToken) != 0 && accessToken[0] != "" {
+		logging.FromContext(ctx).Warn("service: deprecated accessToken metadata key is used, send authorization: Bearer <token> instead")
+		return accessToken[0], nil
 	}
-	return accessToken[0], nil
+	return "", fmt.Errorf("service: no token in metadata")
 }
 
-// Save function method generate order uuid and after that save instance and repository
+// Save function method generate order uuid, mark the caller as order owner and after that save instance and repository
 func (s *Service) Save(ctx context.Context, order *model.Order) (string, error) {
 	order.OrderID = uuid.New().String()
-	err := s.cache.Save(order)
+	if principal, ok := auth.FromContext(ctx); ok {
+		order.OwnerUUID = principal.UserID
+	}
+	err := s.cache.Save(ctx, order)
 	if err != nil {
 		return "", fmt.Errorf("service: can't create order - %w", err)
 	}
@@ -194,26 +463,64 @@ func (s *Service) Save(ctx context.Context, order *model.Order) (string, error)
 	return order.OrderID, nil
 }
 
-// Get method look through cache for order and if order wasn't found, method get it from repository and add it in cache
+// Get method look through cache for order and if order wasn't found, method get it from repository and add it in
+// local cache. Concurrent misses of the same order share one repository query, which isn't cancelled by any of
+// callers and keeps values of context of the first caller, e.g. trace. Order isn't put in cache when it was
+// updated or deleted during the query
 func (s *Service) Get(ctx context.Context, orderID string) (*model.Order, error) {
-	order, found := s.cache.Get(orderID) // add second param as ok
-	if !found {
-		order, err := s.rps.Get(ctx, orderID)
-		if err != nil {
-			return nil, fmt.Errorf("service: can't get order - %w", err)
-		}
-		err = s.cache.Save(order)
+	order, found := s.cache.Get(ctx, orderID)
+	if found {
+		return order, nil
+	}
+	loads := s.orderLoads.DoChan(orderID, func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(detachedContext{parent: ctx}, orderLoadTimeout)
+		defer cancel()
+		version := s.cache.Version(loadCtx, orderID)
+		order, err := s.rps.Get(loadCtx, orderID)
 		if err != nil {
-			return nil, fmt.Errorf("service: can't get order - %w", err)
+			return nil, err
 		}
+		s.cache.Fill(loadCtx, order, version)
 		return order, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("service: can't get order - %w", ctx.Err())
+	case load := <-loads:
+		if load.Err != nil {
+			return nil, fmt.Errorf("service: can't get order - %w", load.Err)
+		}
+		return load.Val.(*model.Order), nil
 	}
-	return order, nil
+}
+
+// orderLoadTimeout limits repository query shared by concurrent cache misses
+const orderLoadTimeout = 10 * time.Second
+
+// detachedContext keeps values of parent context but isn't cancelled with it and has no deadline
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
 }
 
 // Delete method delete order from repository and cache
 func (s *Service) Delete(ctx context.Context, orderID string) error {
-	err := s.cache.Delete(orderID)
+	err := s.cache.Delete(ctx, orderID)
 	if err != nil {
 		return fmt.Errorf("service: can't delete order - %e", err)
 	}
@@ -226,7 +533,7 @@ func (s *Service) Delete(ctx context.Context, orderID string) error {
 
 // Update method update order instance in repository and cache
 func (s *Service) Update(ctx context.Context, order *model.Order) error {
-	err := s.cache.Update(order)
+	err := s.cache.Update(ctx, order)
 	if err != nil {
 		return fmt.Errorf("service: can't update order - %e", err)
 	}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"github.com/EgorBessonov/gRPC/internal/audit"
+	"github.com/EgorBessonov/gRPC/internal/idp"
+	"github.com/EgorBessonov/gRPC/internal/idp/idptest"
+	"github.com/EgorBessonov/gRPC/internal/keyset"
+	"github.com/EgorBessonov/gRPC/internal/lockout"
+	"github.com/EgorBessonov/gRPC/internal/mail"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/EgorBessonov/gRPC/internal/repository"
+	"github.com/google/uuid"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID = "ordercrud"
+	testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testNonce    = "n-0S6_WzA2Mj"
+)
+
+// fakeRepository keeps users, identities, second factors and one-time tokens in memory,
+// methods which tests don't need panic through nil embedded Repository
+type fakeRepository struct {
+	repository.Repository
+	mutex         sync.Mutex
+	users         map[string]*model.AuthUser
+	identities    map[[2]string]string
+	tokens        map[string]*model.OneTimeToken
+	totpSteps     map[string]int64
+	recoveryCodes map[string]map[string]bool
+	// beforeCreate runs before external user is created, it simulates concurrent logins
+	beforeCreate func()
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{
+		users:         make(map[string]*model.AuthUser),
+		identities:    make(map[[2]string]string),
+		tokens:        make(map[string]*model.OneTimeToken),
+		totpSteps:     make(map[string]int64),
+		recoveryCodes: make(map[string]map[string]bool),
+	}
+}
+
+func (r *fakeRepository) addUser(authUser *model.AuthUser) *model.AuthUser {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	authUser.UserUUID = uuid.New().String()
+	r.users[authUser.UserUUID] = authUser
+	return authUser
+}
+
+func (r *fakeRepository) linked(issuer, subject string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.identities[[2]string{issuer, subject}]
+}
+
+func (r *fakeRepository) GetAuthUser(_ context.Context, email string) (*model.AuthUser, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, authUser := range r.users {
+		if authUser.Email == email {
+			copied := *authUser
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeRepository) GetAuthUserByID(_ context.Context, userUUID string) (*model.AuthUser, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	authUser, ok := r.users[userUUID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *authUser
+	return &copied, nil
+}
+
+func (r *fakeRepository) GetAuthUserByIdentity(ctx context.Context, issuer, subject string) (*model.AuthUser, error) {
+	userUUID := r.linked(issuer, subject)
+	if userUUID == "" {
+		return nil, repository.ErrNotFound
+	}
+	return r.GetAuthUserByID(ctx, userUUID)
+}
+
+func (r *fakeRepository) LinkIdentity(_ context.Context, issuer, subject, userUUID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.identities[[2]string{issuer, subject}]; !ok {
+		r.identities[[2]string{issuer, subject}] = userUUID
+	}
+	return nil
+}
+
+func (r *fakeRepository) CreateExternalAuthUser(ctx context.Context, authUser *model.AuthUser, issuer, subject string) error {
+	if r.beforeCreate != nil {
+		r.beforeCreate()
+	}
+	if _, err := r.GetAuthUser(ctx, authUser.Email); err == nil {
+		return repository.ErrAlreadyExists
+	}
+	now := time.Now()
+	authUser.EmailVerifiedAt = &now
+	copied := *authUser
+	r.addUser(&copied)
+	authUser.UserUUID = copied.UserUUID
+	return r.LinkIdentity(ctx, issuer, subject, authUser.UserUUID)
+}
+
+func (r *fakeRepository) UpdatePassword(_ context.Context, userUUID, passwordHash string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.users[userUUID].Password = passwordHash
+	return nil
+}
+
+func (r *fakeRepository) RecordLoginFailure(_ context.Context, userUUID string, _ time.Duration) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.users[userUUID].FailedLogins++
+	return r.users[userUUID].FailedLogins, nil
+}
+
+func (r *fakeRepository) LockAuthUser(_ context.Context, userUUID string, until time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.users[userUUID].LockedUntil = &until
+	return nil
+}
+
+func (r *fakeRepository) UnlockAuthUser(_ context.Context, userUUID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.users[userUUID].FailedLogins, r.users[userUUID].LockedUntil = 0, nil
+	return nil
+}
+
+func (r *fakeRepository) EnableTOTP(_ context.Context, userUUID string, step int64, recoveryCodeHashes []string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := time.Now()
+	r.users[userUUID].TOTPEnabledAt = &now
+	r.totpSteps[userUUID] = step
+	r.recoveryCodes[userUUID] = make(map[string]bool)
+	for _, hash := range recoveryCodeHashes {
+		r.recoveryCodes[userUUID][hash] = true
+	}
+	return nil
+}
+
+func (r *fakeRepository) UseTOTPStep(_ context.Context, userUUID string, step int64) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if step <= r.totpSteps[userUUID] {
+		return false, nil
+	}
+	r.totpSteps[userUUID] = step
+	return true, nil
+}
+
+func (r *fakeRepository) UseRecoveryCode(_ context.Context, userUUID, codeHash string) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.recoveryCodes[userUUID][codeHash] {
+		return false, nil
+	}
+	delete(r.recoveryCodes[userUUID], codeHash)
+	return true, nil
+}
+
+func (r *fakeRepository) SaveOneTimeToken(_ context.Context, token *model.OneTimeToken) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.tokens[token.ID] = token
+	return nil
+}
+
+func (r *fakeRepository) UseOneTimeToken(_ context.Context, tokenID, purpose, tokenHash string) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	token, ok := r.tokens[tokenID]
+	if !ok || token.Purpose != purpose || token.TokenHash != tokenHash || time.Now().After(token.ExpiresAt) {
+		return false, nil
+	}
+	delete(r.tokens, tokenID)
+	return true, nil
+}
+
+func (r *fakeRepository) DeleteOneTimeTokens(_ context.Context, userUUID, purpose string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for id, token := range r.tokens {
+		if token.UserUUID == userUUID && token.Purpose == purpose {
+			delete(r.tokens, id)
+		}
+	}
+	return nil
+}
+
+func (r *fakeRepository) CreateSession(context.Context, *model.Session) error {
+	return nil
+}
+
+func (r *fakeRepository) SaveRefreshToken(context.Context, *model.RefreshToken) error {
+	return nil
+}
+
+func (r *fakeRepository) RevokeOtherSessions(context.Context, string, string) ([]string, error) {
+	return nil, nil
+}
+
+// fakeMailer keeps sent messages
+type fakeMailer struct {
+	mutex    sync.Mutex
+	messages []mail.Message
+}
+
+func (m *fakeMailer) Send(_ context.Context, msg *mail.Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// lastToken return jwt from the last sent message
+func (m *fakeMailer) lastToken(t *testing.T) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.messages) == 0 {
+		t.Fatal("no message was sent")
+	}
+	for _, line := range strings.Split(m.messages[len(m.messages)-1].Body, "\n") {
+		if strings.Count(line, ".") == 2 && !strings.Contains(line, " ") {
+			return line
+		}
+	}
+	t.Fatal("message has no token")
+	return ""
+}
+
+// fixture wires Service with in-memory repository, mailer and mock identity provider
+type fixture struct {
+	service *Service
+	rps     *fakeRepository
+	mailer  *fakeMailer
+	idp     *idptest.Server
+}
+
+func newFixture(t *testing.T) *fixture {
+	server := idptest.NewServer(t)
+	provider, err := idp.New(context.Background(), server.URL, testClientID, "secret", "http://localhost/callback", nil)
+	if err != nil {
+		t.Fatalf("idp.New() error = %v", err)
+	}
+	keys, err := keyset.New(t.TempDir(), keyset.AlgorithmRS256, time.Hour, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("keyset.New() error = %v", err)
+	}
+	policy := lockout.Policy{Threshold: 5, BaseDelay: time.Second, MaxDelay: time.Minute, Lockout: time.Hour}
+	f := &fixture{rps: newFakeRepository(), mailer: &fakeMailer{}, idp: server}
+	f.service = NewService(f.rps, nil, Options{
+		Keys:             keys,
+		Issuer:           "ordercrud",
+		Audience:         "ordercrud",
+		AccessTokenTTL:   time.Minute,
+		RefreshTokenTTL:  time.Hour,
+		Mailer:           f.mailer,
+		AccountLockout:   policy,
+		LoginAttempts:    lockout.NewTracker(policy),
+		Audit:            audit.NewLogger(io.Discard),
+		MFAChallengeTTL:  time.Minute,
+		IdentityProvider: provider,
+		IdentityLinkTTL:  time.Hour,
+		ReauthTTL:        5 * time.Minute,
+	})
+	return f
+}
+
+func TestAuthenticationInvalidCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		// hasPassword sets password "secret" to existing account
+		hasPassword bool
+	}{
+		{name: "unknown email", email: "other@example.com", password: "secret", hasPassword: true},
+		{name: "wrong password", email: "user@example.com", password: "other", hasPassword: true},
+		{name: "account without password", email: "user@example.com", password: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			authUser := &model.AuthUser{Email: "user@example.com"}
+			if tt.hasPassword {
+				authUser.Password, _ = hashPassword("secret")
+			}
+			f.rps.addUser(authUser)
+			if _, err := f.service.Authentication(context.Background(), tt.email, tt.password); err != errInvalidCredentials {
+				t.Errorf("Authentication() error = %v, want %v", err, errInvalidCredentials)
+			}
+		})
+	}
+}
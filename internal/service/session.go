@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/auth"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+)
+
+// maxDeviceLength limits size of client provided device description
+const maxDeviceLength = 256
+
+// ListSessions method returns active sessions of the caller and id of the current one
+func (s *Service) ListSessions(ctx context.Context) ([]model.Session, string, error) {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("service: can't list sessions - %w", err)
+	}
+	sessions, err := s.rps.GetUserSessions(ctx, principal.UserID)
+	if err != nil {
+		return nil, "", fmt.Errorf("service: can't list sessions - %w", err)
+	}
+	return sessions, principal.SessionID, nil
+}
+
+// RevokeSession method revokes one of the caller sessions
+func (s *Service) RevokeSession(ctx context.Context, sessionID string) error {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return fmt.Errorf("service: can't revoke session - %w", err)
+	}
+	session, err := s.rps.GetSession(ctx, sessionID)
+	if err != nil || session.UserUUID != principal.UserID {
+		// sessions of other users are reported as missing
+		return fmt.Errorf("service: session %s not found", sessionID)
+	}
+	if err := s.rps.RevokeSession(ctx, sessionID); err != nil {
+		return fmt.Errorf("service: can't revoke session - %w", err)
+	}
+	if err := s.revokeAccessTokens(ctx, &model.Revocation{SessionID: sessionID}); err != nil {
+		return fmt.Errorf("service: can't revoke session - %w", err)
+	}
+	return nil
+}
+
+// LogoutAll method revokes all sessions of the caller
+func (s *Service) LogoutAll(ctx context.Context) error {
+	principal, err := sessionPrincipal(ctx)
+	if err != nil {
+		return fmt.Errorf("service: logout failed - %w", err)
+	}
+	if err := s.revokeUser(ctx, principal.UserID); err != nil {
+		return fmt.Errorf("service: logout failed - %w", err)
+	}
+	return nil
+}
+
+// revokeReusedFamily revokes every token of the family when already rotated refresh token
+// is presented again, it means that the token was stolen by someone
+func (s *Service) revokeReusedFamily(ctx context.Context, token *model.RefreshToken) error {
+	logging.FromContext(ctx).WithFields(log.Fields{
+		"userID":   token.UserUUID,
+		"familyID": token.FamilyID,
+	}).Warn("service: refresh token reuse detected, token family is revoked")
+	if err := s.rps.RevokeSession(ctx, token.FamilyID); err != nil {
+		return fmt.Errorf("service: can't revoke reused token family - %w", err)
+	}
+	if err := s.revokeAccessTokens(ctx, &model.Revocation{SessionID: token.FamilyID}); err != nil {
+		return fmt.Errorf("service: can't revoke reused token family - %w", err)
+	}
+	return fmt.Errorf("service: refresh token was already used")
+}
+
+// sessionPrincipal return principal of the caller access token
+func sessionPrincipal(ctx context.Context) (*auth.Principal, error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok || principal.UserID == "" || principal.SessionID == "" {
+		return nil, fmt.Errorf("service: caller has no session")
+	}
+	return principal, nil
+}
+
+// hashToken return hex encoded sha256 of token, tokens are random enough to not require salt
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// deviceFromContext return client user agent which describes device of the session
+func deviceFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	userAgent := md.Get("user-agent")
+	if len(userAgent) == 0 {
+		return ""
+	}
+	if len(userAgent[0]) > maxDeviceLength {
+		return userAgent[0][:maxDeviceLength]
+	}
+	return userAgent[0]
+}
+
+// peerFromContext return network address of the client
+func peerFromContext(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	return p.Addr.String()
+}
+
+// peerHost return network address of the client without port
+func peerHost(ctx context.Context) string {
+	addr := peerFromContext(ctx)
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
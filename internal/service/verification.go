@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/mail"
+	"github.com/EgorBessonov/gRPC/internal/model"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// tokenTypeEmailVerification marks one-time tokens which confirm user email
+const tokenTypeEmailVerification = "email_verification"
+
+// VerifyEmail method checks email verification token and marks email of its user as verified
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	authUser, err := s.useOneTimeToken(ctx, token, tokenTypeEmailVerification)
+	if err != nil {
+		return fmt.Errorf("service: email verification failed - %w", err)
+	}
+	if err := s.rps.VerifyEmail(ctx, authUser.UserUUID); err != nil {
+		return fmt.Errorf("service: email verification failed - %w", err)
+	}
+	return nil
+}
+
+// sendEmailVerification issues email verification token and sends it to the user
+func (s *Service) sendEmailVerification(ctx context.Context, authUser *model.AuthUser) error {
+	token, err := s.issueOneTimeToken(ctx, authUser, tokenTypeEmailVerification, s.opts.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return s.opts.Mailer.Send(ctx, &mail.Message{
+		To:      authUser.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Hello %s,\n\nuse the following token to confirm your email, it is valid for %s:\n\n%s\n",
+			authUser.UserName, s.opts.EmailVerificationTTL, token),
+	})
+}
+
+// issueOneTimeToken return signed token of tokenType for the user, token id and hash
+// are stored to allow using the token only once
+func (s *Service) issueOneTimeToken(ctx context.Context, authUser *model.AuthUser, tokenType string, ttl time.Duration) (string, error) {
+	return s.issueOneTimeTokenWithClaims(ctx, authUser, &CustomClaims{Type: tokenType}, ttl)
+}
+
+// issueOneTimeTokenWithClaims works like issueOneTimeToken, claims carry token type and data which
+// token is issued for, user and standard claims are filled in
+func (s *Service) issueOneTimeTokenWithClaims(ctx context.Context, authUser *model.AuthUser, claims *CustomClaims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	tokenType := claims.Type
+	claims.Email = authUser.Email
+	claims.StandardClaims = jwt.StandardClaims{
+		Subject:   authUser.UserUUID,
+		Issuer:    s.opts.Issuer,
+		Audience:  s.opts.Audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+		Id:        uuid.New().String(),
+	}
+	tokenString, err := s.opts.Keys.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("service: can't generate %s token - %w", tokenType, err)
+	}
+	err = s.rps.SaveOneTimeToken(ctx, &model.OneTimeToken{
+		ID:        claims.Id,
+		UserUUID:  authUser.UserUUID,
+		Purpose:   tokenType,
+		TokenHash: hashToken(tokenString),
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", fmt.Errorf("service: can't save %s token - %w", tokenType, err)
+	}
+	return tokenString, nil
+}
+
+// useOneTimeToken checks one-time token of tokenType and marks it as used, token is valid
+// only while user email is the same as when the token was issued
+func (s *Service) useOneTimeToken(ctx context.Context, tokenString, tokenType string) (*model.AuthUser, error) {
+	authUser, _, err := s.useOneTimeTokenClaims(ctx, tokenString, tokenType)
+	return authUser, err
+}
+
+// useOneTimeTokenClaims works like useOneTimeToken and also returns claims of the token
+func (s *Service) useOneTimeTokenClaims(ctx context.Context, tokenString, tokenType string) (*model.AuthUser, *CustomClaims, error) {
+	claims, err := s.parseToken(tokenString, tokenType)
+	if err != nil {
+		return nil, nil, err
+	}
+	authUser, err := s.rps.GetAuthUserByID(ctx, claims.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	if authUser.Email != claims.Email {
+		return nil, nil, fmt.Errorf("service: token was issued for another email")
+	}
+	used, err := s.rps.UseOneTimeToken(ctx, claims.Id, tokenType, hashToken(tokenString))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !used {
+		return nil, nil, fmt.Errorf("service: token was already used or expired")
+	}
+	return authUser, claims, nil
+}
+
+// normalizeEmail return email in the form it's stored, emails which differ only by case belong to the same user
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
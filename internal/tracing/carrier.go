@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"github.com/segmentio/kafka-go"
+	"github.com/streadway/amqp"
+)
+
+// AMQPHeadersCarrier adapts amqp message headers to propagation.TextMapCarrier
+type AMQPHeadersCarrier amqp.Table
+
+// Get return header value for key
+func (c AMQPHeadersCarrier) Get(key string) string {
+	value, ok := c[key].(string)
+	if !ok {
+		return ""
+	}
+	return value
+}
+
+// Set store header value for key
+func (c AMQPHeadersCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+// Keys return header keys
+func (c AMQPHeadersCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// KafkaHeadersCarrier adapts kafka message headers to propagation.TextMapCarrier
+type KafkaHeadersCarrier struct {
+	Headers *[]kafka.Header
+}
+
+// Get return header value for key
+func (c KafkaHeadersCarrier) Get(key string) string {
+	for _, header := range *c.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// Set store header value for key, existing header with the same key is replaced
+func (c KafkaHeadersCarrier) Set(key, value string) {
+	for i, header := range *c.Headers {
+		if header.Key == key {
+			(*c.Headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.Headers = append(*c.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+// Keys return header keys
+func (c KafkaHeadersCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.Headers))
+	for _, header := range *c.Headers {
+		keys = append(keys, header.Key)
+	}
+	return keys
+}
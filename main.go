@@ -3,20 +3,41 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/EgorBessonov/gRPC/internal/audit"
 	"github.com/EgorBessonov/gRPC/internal/broker"
 	"github.com/EgorBessonov/gRPC/internal/cache"
+	"github.com/EgorBessonov/gRPC/internal/certs"
 	"github.com/EgorBessonov/gRPC/internal/config"
+	"github.com/EgorBessonov/gRPC/internal/httpserver"
+	"github.com/EgorBessonov/gRPC/internal/idp"
+	"github.com/EgorBessonov/gRPC/internal/interceptor"
+	"github.com/EgorBessonov/gRPC/internal/keyset"
+	"github.com/EgorBessonov/gRPC/internal/lockout"
+	"github.com/EgorBessonov/gRPC/internal/logging"
+	"github.com/EgorBessonov/gRPC/internal/mail"
+	"github.com/EgorBessonov/gRPC/internal/metrics"
 	ordercrud "github.com/EgorBessonov/gRPC/internal/protocol"
+	"github.com/EgorBessonov/gRPC/internal/ratelimit"
 	"github.com/EgorBessonov/gRPC/internal/repository"
+	"github.com/EgorBessonov/gRPC/internal/revocation"
 	"github.com/EgorBessonov/gRPC/internal/server"
 	"github.com/EgorBessonov/gRPC/internal/service"
+	"github.com/EgorBessonov/gRPC/internal/tracing"
 	"github.com/caarlos0/env"
+	"github.com/go-redis/redis/v8"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/segmentio/kafka-go"
 	log "github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"io"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -31,37 +52,134 @@ func main() {
 	if err := env.Parse(&cfg); err != nil {
 		log.Fatal("config parsing failed")
 	}
+	log.AddHook(logging.NewRedactionHook(append(logging.DefaultRedactedFields, cfg.LogRedactFields...)))
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	shutdownTracing, err := tracing.Init(ctx, cfg.TracingExporter, cfg.OTLPEndpoint, cfg.OTLPInsecure)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// other replicas reload keys every check period and JWKS clients cache keys for JWKSMaxAge,
+	// so new key signs tokens only after both of them know it
+	keys, err := keyset.New(cfg.JWTKeysDir, cfg.JWTAlgorithm, cfg.JWTKeyRotation, cfg.RefreshTokenTTL,
+		keyset.JWKSMaxAge+cfg.JWTKeyCheckPeriod)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go keys.Run(ctx, cfg.JWTKeyCheckPeriod)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/.well-known/jwks.json", keys.Handler())
+	httpServer := httpserver.NewServer(cfg.HTTPPort, mux)
+	httpServer.Start()
 	repos := dbConnection(cfg)
 	conn, rabbitCli, err := rabbitConnection(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer func() {
-		if err := rabbitCli.Channel.Close(); err != nil {
-			log.Errorf("rabbitmq: error while closing channel - %e", err)
-		}
-		if err := conn.Close(); err != nil {
-			log.Errorf("rabbitmq: error while closing connection - %e, err")
-		}
-	}()
-	cacheContext := context.Background()
+	revocations := revocation.New(repos, conn, rabbitCli)
+	if err := revocations.Load(ctx); err != nil {
+		log.Error(err)
+	}
+	go revocations.Run(ctx)
 	kafkaConn, err := kafkaConnection(&cfg)
 	if err != nil {
-		log.Fatal("kafka: connection failed - %e", err)
+		log.Fatalf("kafka: connection failed - %v", err)
 	}
-	defer func() {
-		if err := conn.Close(); err != nil {
-			log.Error("kafka: error while closing connection")
-		}
-	}()
 	kReader, err := kafkaReader(&cfg)
 	if err != nil {
-		log.Fatal("kafka: error while creating reader - %e", err)
+		log.Fatalf("kafka: error while creating reader - %v", err)
+	}
+	kafkaCli := broker.NewKafkaClient(kafkaConn)
+	kafkaReader := broker.NewKafkaReader(kReader)
+	cacheContext, cancelCache := context.WithCancel(context.Background())
+	orderCache, err := newOrderCache(cacheContext, &cfg, kafkaReader, rabbitCli)
+	if err != nil {
+		log.Fatal(err)
 	}
-	orderCache := cache.NewCache(cacheContext, broker.NewKafkaClient(kafkaConn), broker.NewKafkaReader(kReader), cfg.RabbitQueueName, rabbitCli)
-	orderService := service.NewService(repos, orderCache)
+	auditOut, err := auditOutput(&cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mailer, err := newMailer(&cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	identityProvider, err := newIdentityProvider(ctx, &cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	orderService := service.NewService(repos, orderCache, service.Options{
+		Keys:                     keys,
+		Revocations:              revocations,
+		Issuer:                   cfg.JWTIssuer,
+		Audience:                 cfg.JWTAudience,
+		AccessTokenTTL:           cfg.AccessTokenTTL,
+		RefreshTokenTTL:          cfg.RefreshTokenTTL,
+		Mailer:                   mailer,
+		RequireEmailVerification: cfg.RequireEmailVerification,
+		EmailVerificationTTL:     cfg.EmailVerificationTTL,
+		PasswordResetTTL:         cfg.PasswordResetTTL,
+		AccountLockout:           loginPolicy(&cfg, cfg.LoginMaxFailures),
+		LoginAttempts:            lockout.NewTracker(loginPolicy(&cfg, cfg.LoginIPMaxFailures)),
+		Audit:                    audit.NewLogger(auditOut),
+		TOTPIssuer:               cfg.TOTPIssuer,
+		MFAChallengeTTL:          cfg.MFAChallengeTTL,
+		IdentityProvider:         identityProvider,
+		IdentityLinkTTL:          cfg.OIDCLinkTTL,
+		ReauthTTL:                cfg.OIDCReauthTTL,
+	})
 	gRPCServer := server.NewServer(orderService)
-	newgRPCServer(cfg.PortgRPC, gRPCServer)
+	gServer, lis := newgRPCServer(&cfg, gRPCServer, orderService, revocations)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- gServer.Serve(lis)
+	}()
+	select {
+	case <-ctx.Done():
+		log.Info("shutdown signal received")
+	case err := <-serveErr:
+		log.Errorf("gRPC server failed - %v", err)
+	}
+	stop()
+
+	// teardown goes in reverse dependency order: rpc handlers publish to brokers and query postgres,
+	// consumers write into cache, so server stops first and database pool closes last
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	stopgRPCServer(shutdownCtx, gServer)
+	if err := orderService.Drain(shutdownCtx); err != nil {
+		log.Error(err)
+	}
+	cancelCache()
+	if err := orderCache.Drain(shutdownCtx); err != nil {
+		log.Error(err)
+	}
+	if err := kafkaReader.Close(); err != nil {
+		log.Error(err)
+	}
+	if err := kafkaCli.Close(); err != nil {
+		log.Error(err)
+	}
+	if err := rabbitCli.Close(); err != nil {
+		log.Error(err)
+	}
+	if err := conn.Close(); err != nil {
+		log.Errorf("rabbitmq: error while closing connection - %v", err)
+	}
+	if err := repos.CloseDBConnection(); err != nil {
+		log.Error(err)
+	}
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("http server: error while stopping - %v", err)
+	}
+	if err := auditOut.Close(); err != nil {
+		log.Errorf("audit: error while closing log - %v", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Errorf("tracing: error while flushing spans - %v", err)
+	}
+	log.Info("shutdown completed")
 }
 
 // return new rabbit client instance
@@ -85,7 +203,19 @@ func rabbitConnection(cfg config.Config) (*amqp.Connection, *broker.RabbitClient
 	if err != nil {
 		return conn, nil, fmt.Errorf("rabbitmq: error while creating queue - %e", err)
 	}
-	rabbitClient := broker.NewRabbit(ch, &q)
+	err = ch.ExchangeDeclare(
+		cfg.RabbitRevocationExchange,
+		amqp.ExchangeFanout,
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return conn, nil, fmt.Errorf("rabbitmq: error while creating revocation exchange - %w", err)
+	}
+	rabbitClient := broker.NewRabbit(ch, &q, cfg.RabbitRevocationExchange)
 	log.Printf("rabbitmq: succsfully connected at %s:%s", cfg.RabbitHost, cfg.RabbitPort)
 	return conn, rabbitClient, nil
 }
@@ -130,35 +260,162 @@ func dbConnection(cfg config.Config) repository.Repository {
 		log.WithFields(log.Fields{
 			"status": "successfully connected to postgres database.",
 		}).Info("postgres repository info.")
+		prometheus.MustRegister(metrics.NewPoolCollector(conn))
 	}
 	return repository.PostgresRepository{DBconn: conn}
 }
 
-// start gRPC server
-func newgRPCServer(port string, s *server.Server) {
-	lis, err := net.Listen("tcp", port)
+// create gRPC server and listener for it, server uses tls when certificate is configured
+func newgRPCServer(cfg *config.Config, s *server.Server, validator interceptor.TokenValidator,
+	revocations interceptor.RevocationChecker) (*grpc.Server, net.Listener) {
+	lis, err := net.Listen("tcp", cfg.PortgRPC)
+	if err != nil {
+		log.Fatal("gRPC server failed - ", err)
+	}
+	peerLimiter, limiter, err := newRateLimiters(cfg)
 	if err != nil {
 		log.Fatal("gRPC server failed - ", err)
 	}
-	gServer := grpc.NewServer(grpc.UnaryInterceptor(unaryInterceptor))
+	opts := interceptor.ServerOptions(validator, revocations, peerLimiter, limiter)
+	if cfg.TLSCertFile != "" {
+		reloader, err := certs.NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile)
+		if err != nil {
+			log.Fatal("gRPC server failed - ", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.TLSConfig())))
+		log.Printf("gRPC server: tls enabled, mutual tls - %t", cfg.TLSClientCAFile != "")
+	}
+	gServer := grpc.NewServer(opts...)
 	ordercrud.RegisterCRUDServer(gServer, s)
 	log.Printf("gRPC server listening at %s", lis.Addr())
-	if err = gServer.Serve(lis); err != nil {
-		log.Fatal("gRPC server failed - ", err)
-		return
+	return gServer, lis
+}
+
+// create rate limiters with in-memory buckets store, peer limiter applies one limit to all
+// methods called from the same ip and limiter applies method limits to callers
+func newRateLimiters(cfg *config.Config) (*ratelimit.Limiter, *ratelimit.Limiter, error) {
+	peerLimit, err := ratelimit.ParseLimit(cfg.RateLimitPeer)
+	if err != nil {
+		return nil, nil, err
+	}
+	defaultLimit, err := ratelimit.ParseLimit(cfg.RateLimitDefault)
+	if err != nil {
+		return nil, nil, err
+	}
+	limits, err := ratelimit.ParseMethodLimits(cfg.RateLimits)
+	if err != nil {
+		return nil, nil, err
+	}
+	store := ratelimit.NewMemoryStore()
+	return ratelimit.NewLimiter(store, peerLimit, nil), ratelimit.NewLimiter(store, defaultLimit, limits), nil
+}
+
+// create order cache of configured backend and run its consumers, consumers stop when ctx is cancelled
+func newOrderCache(ctx context.Context, cfg *config.Config, kafkaReader *broker.KafkaReader,
+	rabbitCli *broker.RabbitClient) (cache.OrderCache, error) {
+	switch cfg.CacheBackend {
+	case cache.BackendMemory:
+		orderCache := cache.NewCache(rabbitCli, cache.Options{
+			MaxEntries: cfg.CacheMaxEntries,
+			MaxBytes:   cfg.CacheMaxBytes,
+			TTL:        cfg.CacheTTL,
+		})
+		orderCache.Consume(ctx, kafkaReader, cfg.RabbitQueueName, rabbitCli)
+		return orderCache, nil
+	case cache.BackendRedis:
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		})
+		if err := client.Ping(ctx).Err(); err != nil {
+			return nil, fmt.Errorf("redis: connection failed - %w", err)
+		}
+		log.Printf("redis: successfully connected at %s", cfg.RedisAddr)
+		orderCache := cache.NewRedisCache(client, rabbitCli, cfg.RedisKeyPrefix, cfg.CacheTTL)
+		orderCache.Consume(ctx, kafkaReader, cfg.RabbitQueueName, rabbitCli)
+		return orderCache, nil
+	default:
+		return nil, fmt.Errorf("cache: unsupported backend %q", cfg.CacheBackend)
 	}
 }
 
-// create interceptor for jwt authentication
-func unaryInterceptor(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	switch info.FullMethod {
-	case "/protocol.CRUD/GetOrder", "/protocol.CRUD/SaveOrder", "/protocol.CRUD/DeleteOrder", "/protocol.CRUD/UpdateOrder":
-		if ok, err := service.ValidateToken(ctx); !ok {
-			log.Errorf("server: %e", err)
-			return nil, err
+// create mailer of configured type
+func newMailer(cfg *config.Config) (mail.Mailer, error) {
+	switch cfg.Mailer {
+	case mail.MailerSMTP:
+		return mail.NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUser, cfg.SMTPPassword, cfg.MailFrom)
+	case mail.MailerFile:
+		return mail.NewFileMailer(cfg.MailDir, cfg.MailFrom)
+	case mail.MailerLog:
+		// messages carry verification and reset tokens, so they are never written into log outside development
+		if !cfg.MailLogDev {
+			return nil, fmt.Errorf("mail: %q mailer is allowed only when MAILLOGDEV is set", cfg.Mailer)
 		}
-		return handler(ctx, request)
+		return mail.LogMailer{}, nil
+	case "":
+		return nil, fmt.Errorf("mail: mailer is not configured, MAILER must be set")
 	default:
-		return handler(ctx, request)
+		return nil, fmt.Errorf("mail: unsupported mailer %q", cfg.Mailer)
+	}
+}
+
+// create external identity provider client, oidc login is disabled when issuer isn't configured
+func newIdentityProvider(ctx context.Context, cfg *config.Config) (*idp.Provider, error) {
+	if cfg.OIDCIssuer == "" {
+		return nil, nil
+	}
+	provider, err := idp.New(ctx, cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.OIDCRedirectURL, cfg.OIDCScopes)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("oidc: login with %s enabled", cfg.OIDCIssuer)
+	return provider, nil
+}
+
+// return login lockout policy with given failures threshold
+func loginPolicy(cfg *config.Config, threshold int) lockout.Policy {
+	return lockout.Policy{
+		Threshold: threshold,
+		BaseDelay: cfg.LoginBackoffBase,
+		MaxDelay:  cfg.LoginBackoffMax,
+		Lockout:   cfg.LoginLockout,
+	}
+}
+
+// open audit log file, audit events go to stdout when file isn't configured
+func auditOutput(cfg *config.Config) (io.WriteCloser, error) {
+	if cfg.AuditLogFile == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	file, err := os.OpenFile(cfg.AuditLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("audit: can't open log file - %w", err)
+	}
+	return file, nil
+}
+
+// nopCloser keeps standard output open when audit log is closed
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// stop gRPC server gracefully, in-flight rpc are forcibly closed when ctx expires
+func stopgRPCServer(ctx context.Context, gServer *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		gServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		log.Info("gRPC server stopped")
+	case <-ctx.Done():
+		gServer.Stop()
+		log.Warn("gRPC server graceful stop timed out, remaining rpc were cancelled")
 	}
 }
@@ -0,0 +1 @@
+alter table authusers drop column if exists roles;
@@ -0,0 +1 @@
+alter table authusers add column if not exists roles text[] not null default '{}';
@@ -0,0 +1 @@
+-- argon2id hashes do not fit into previous column size, so the change is not reverted
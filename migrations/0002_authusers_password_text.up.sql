@@ -0,0 +1 @@
+alter table authusers alter column password type text;
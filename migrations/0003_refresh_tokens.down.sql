@@ -0,0 +1,3 @@
+alter table authusers add column if not exists refreshtoken text;
+
+drop table if exists refresh_tokens;
@@ -0,0 +1,16 @@
+create table if not exists refresh_tokens (
+    id         uuid primary key,
+    family_id  uuid        not null,
+    useruuid   uuid        not null,
+    token_hash text        not null,
+    device     text        not null default '',
+    created_at timestamptz not null default now(),
+    expires_at timestamptz not null,
+    used_at    timestamptz,
+    revoked_at timestamptz
+);
+
+create index if not exists refresh_tokens_family_id_idx on refresh_tokens (family_id);
+create index if not exists refresh_tokens_useruuid_idx on refresh_tokens (useruuid);
+
+alter table authusers drop column if exists refreshtoken;
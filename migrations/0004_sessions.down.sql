@@ -0,0 +1,8 @@
+alter table refresh_tokens add column if not exists device text not null default '';
+
+update refresh_tokens t
+set device = s.device
+from sessions s
+where s.id = t.family_id;
+
+drop table if exists sessions;
@@ -0,0 +1,25 @@
+create table if not exists sessions (
+    id           uuid primary key,
+    useruuid     uuid        not null,
+    device       text        not null default '',
+    peer_addr    text        not null default '',
+    created_at   timestamptz not null default now(),
+    last_used_at timestamptz not null default now(),
+    revoked_at   timestamptz
+);
+
+create index if not exists sessions_useruuid_idx on sessions (useruuid);
+
+-- every refresh token family issued before this migration becomes a session
+insert into sessions (id, useruuid, device, created_at, last_used_at, revoked_at)
+select family_id,
+       useruuid,
+       (array_agg(device order by created_at))[1],
+       min(created_at),
+       max(created_at),
+       case when bool_and(revoked_at is not null) then max(revoked_at) end
+from refresh_tokens
+group by family_id, useruuid
+on conflict (id) do nothing;
+
+alter table refresh_tokens drop column if exists device;
@@ -0,0 +1,10 @@
+create table if not exists token_revocations (
+    id            bigserial primary key,
+    token_id      text,
+    session_id    uuid,
+    useruuid      uuid,
+    issued_before timestamptz not null,
+    expires_at    timestamptz not null
+);
+
+create index if not exists token_revocations_expires_at_idx on token_revocations (expires_at);
@@ -0,0 +1,3 @@
+drop table if exists one_time_tokens;
+
+alter table authusers drop column if exists email_verified_at;
@@ -0,0 +1,15 @@
+alter table authusers add column if not exists email_verified_at timestamptz;
+
+-- accounts registered before verification was introduced are trusted
+update authusers set email_verified_at = now() where email_verified_at is null;
+
+create table if not exists one_time_tokens (
+    id         uuid primary key,
+    useruuid   uuid        not null,
+    purpose    text        not null,
+    created_at timestamptz not null default now(),
+    expires_at timestamptz not null,
+    used_at    timestamptz
+);
+
+create index if not exists one_time_tokens_useruuid_idx on one_time_tokens (useruuid);
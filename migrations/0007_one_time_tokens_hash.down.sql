@@ -0,0 +1 @@
+alter table one_time_tokens drop column if exists token_hash;
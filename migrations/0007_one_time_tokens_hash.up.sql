@@ -0,0 +1,2 @@
+-- tokens issued before this migration have no hash and can't be used anymore
+alter table one_time_tokens add column if not exists token_hash text not null default '';
@@ -0,0 +1,2 @@
+alter table authusers drop column if exists locked_until;
+alter table authusers drop column if exists failed_logins;
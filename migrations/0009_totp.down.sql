@@ -0,0 +1,5 @@
+drop table if exists recovery_codes;
+
+alter table authusers drop column if exists totp_last_step;
+alter table authusers drop column if exists totp_enabled_at;
+alter table authusers drop column if exists totp_secret;
@@ -0,0 +1,14 @@
+alter table authusers add column if not exists totp_secret text not null default '';
+alter table authusers add column if not exists totp_enabled_at timestamptz;
+-- time step of the last accepted code, codes of the same or earlier steps are rejected as replayed
+alter table authusers add column if not exists totp_last_step bigint not null default 0;
+
+create table if not exists recovery_codes (
+    id         bigserial primary key,
+    useruuid   uuid        not null,
+    code_hash  text        not null,
+    created_at timestamptz not null default now(),
+    used_at    timestamptz
+);
+
+create index if not exists recovery_codes_useruuid_idx on recovery_codes (useruuid);
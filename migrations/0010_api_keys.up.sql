@@ -0,0 +1,14 @@
+create table if not exists api_keys (
+    id           uuid primary key,
+    useruuid     uuid        not null,
+    name         text        not null default '',
+    prefix       text        not null unique,
+    key_hash     text        not null,
+    scopes       text[]      not null default '{}',
+    created_at   timestamptz not null default now(),
+    last_used_at timestamptz,
+    expires_at   timestamptz,
+    revoked_at   timestamptz
+);
+
+create index if not exists api_keys_useruuid_idx on api_keys (useruuid);
@@ -0,0 +1,5 @@
+alter table authusers drop column if exists deleted_at;
+
+drop index if exists orders_owner_uuid_idx;
+
+alter table orders drop column if exists owner_uuid;
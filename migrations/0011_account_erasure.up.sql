@@ -0,0 +1,7 @@
+-- orders created before this migration have no owner
+alter table orders add column if not exists owner_uuid uuid;
+
+create index if not exists orders_owner_uuid_idx on orders (owner_uuid);
+
+-- personal data of deleted accounts is erased, the row is kept so the id isn't reused
+alter table authusers add column if not exists deleted_at timestamptz;
@@ -0,0 +1,2 @@
+-- normalized emails are kept, original case can't be restored
+drop table if exists authusers_email_conflicts;
@@ -0,0 +1,31 @@
+-- accounts whose emails differ only by case or surrounding spaces are reported here, they have
+-- to be merged or renamed by hand before 0013_authusers_email_unique can be applied
+create table if not exists authusers_email_conflicts (
+    useruuid         uuid primary key,
+    email            text        not null,
+    normalized_email text        not null,
+    detected_at      timestamptz not null default now()
+);
+
+insert into authusers_email_conflicts (useruuid, email, normalized_email)
+select useruuid, email, lower(trim(email))
+from authusers
+where lower(trim(email)) in (
+    select lower(trim(email)) from authusers group by lower(trim(email)) having count(*) > 1
+)
+on conflict (useruuid) do nothing;
+
+-- emails without conflicts are stored normalized
+update authusers set email = lower(trim(email))
+where email <> lower(trim(email))
+  and useruuid not in (select useruuid from authusers_email_conflicts);
+
+do $$
+declare
+    conflicts integer;
+begin
+    select count(distinct normalized_email) into conflicts from authusers_email_conflicts;
+    if conflicts > 0 then
+        raise warning '% emails are shared by several accounts, see authusers_email_conflicts', conflicts;
+    end if;
+end $$;
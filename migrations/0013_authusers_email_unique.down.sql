@@ -0,0 +1 @@
+drop index if exists authusers_email_lower_key;
@@ -0,0 +1,15 @@
+do $$
+declare
+    conflicts integer;
+begin
+    select count(*) into conflicts from (
+        select 1 from authusers group by lower(trim(email)) having count(*) > 1
+    ) duplicates;
+    if conflicts > 0 then
+        raise exception '% emails are shared by several accounts, resolve them using authusers_email_conflicts first', conflicts;
+    end if;
+end $$;
+
+update authusers set email = lower(trim(email)) where email <> lower(trim(email));
+
+create unique index if not exists authusers_email_lower_key on authusers (lower(email));
@@ -0,0 +1,9 @@
+create table if not exists external_identities (
+    issuer     text        not null,
+    subject    text        not null,
+    useruuid   uuid        not null,
+    created_at timestamptz not null default now(),
+    primary key (issuer, subject)
+);
+
+create index if not exists external_identities_useruuid_idx on external_identities (useruuid);
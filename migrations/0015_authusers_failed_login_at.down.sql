@@ -0,0 +1 @@
+alter table authusers drop column if exists last_failed_login_at;
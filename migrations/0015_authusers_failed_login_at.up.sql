@@ -0,0 +1 @@
+alter table authusers add column if not exists last_failed_login_at timestamptz;